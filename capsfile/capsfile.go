@@ -41,23 +41,24 @@ func (cf *CapsFile) Version() int { return cf.version }
 func (cf *CapsFile) ExpiresAfter() time.Duration { return cf.expiresAfter }
 
 func (cf *CapsFile) TLSPort() int {
-	v, _, _ := cf.Int64(capKeyTLSPort)
-	return int(v)
+	v, _, _ := cf.ServerTLSPort()
+	return v
 }
 
 func (cf *CapsFile) Supports(feature gopher.Feature) gopher.FeatureStatus {
+	var v, ok bool
 	switch feature {
 	case gopher.FeatureIIbis:
-		v, _, _ := cf.Bool(capKeyGopherIIbis)
-		return featureStatusFromBool(v)
+		v, ok, _ = cf.SupportsGopherIIbis()
 	case gopher.FeatureII:
-		v, _, _ := cf.Bool(capKeyGopherII)
-		return featureStatusFromBool(v)
+		v, ok, _ = cf.SupportsGopherII()
 	case gopher.FeaturePlusAsk:
-		v, _, _ := cf.Bool(capKeyGopherPlusAsk)
-		return featureStatusFromBool(v)
+		v, ok, _ = cf.SupportsGopherPlusAsk()
 	}
-	return gopher.FeatureStatusUnknown
+	if !ok {
+		return gopher.FeatureStatusUnknown
+	}
+	return featureStatusFromBool(v)
 }
 
 func (cf *CapsFile) String(key string) (s string, ok bool) {
@@ -78,35 +79,38 @@ func (cf *CapsFile) Bool(key string) (v bool, ok bool, err error) {
 }
 
 func (cf *CapsFile) Int64(key string) (v int64, ok bool, err error) {
-	kv := cf.keyIndex[key]
+	kv := cf.keyIndex[strings.ToLower(key)]
 	if kv == nil {
 		return 0, false, nil
 	}
-	v, err = strconv.ParseInt(key, 10, 64)
+	v, err = strconv.ParseInt(kv.Value, 10, 64)
 	return v, true, err
 }
 
 func (cf *CapsFile) Software() (name, version string) {
-	name, _ = cf.String("ServerSoftware")
-	version, _ = cf.String("ServerVersion")
+	name, _, _ = cf.ServerSoftware()
+	version, _, _ = cf.ServerSoftwareVersion()
 	return name, version
 }
 
 func (cf *CapsFile) ServerInfo() (*gopher.ServerInfo, error) {
 	var si gopher.ServerInfo
 
-	si.Software, _ = cf.String("ServerSoftware")
-	si.Version, _ = cf.String("ServerVersion")
-	si.Architecture, _ = cf.String("ServerArchitecture")
-	si.Description, _ = cf.String("ServerDescription")
-	si.Geolocation, _ = cf.String("ServerGeolocationString")
+	si.Software, _, _ = cf.ServerSoftware()
+	si.Version, _, _ = cf.ServerSoftwareVersion()
+	si.Architecture, _, _ = cf.ServerArchitecture()
+	si.Description, _, _ = cf.ServerDescription()
+	si.Geolocation, _, _ = cf.ServerGeolocationString()
+
+	// The email is returned as-is rather than parsed so that we don't lose
+	// anything; Validate() will complain if it's bodgy.
 	si.AdminEmail, _ = cf.String("ServerAdmin")
 
 	return &si, nil
 }
 
 func (cf *CapsFile) DefaultEncoding() string {
-	enc, _ := cf.String("DefaultEncoding")
+	enc, _, _ := cf.ServerDefaultEncoding()
 	return enc
 }
 
@@ -115,36 +119,32 @@ func (cf *CapsFile) PathConfig() (*gopher.PathConfig, error) {
 
 	var errs []string
 
-	// XXX: The caps key is 'PathDelimeter', which is a real-world common-use misspelling
-	// a-la 'HTTP Referer':
-	if d, ok := cf.String("PathDelimeter"); ok {
+	if d, ok, _ := cf.PathDelimeter(); ok {
 		pc.Delimiter = d
 	}
-	if d, ok := cf.String("PathIdentity"); ok {
+	if d, ok, _ := cf.PathIdentity(); ok {
 		pc.Identity = d
 	}
-	if d, ok := cf.String("PathParent"); ok {
+	if d, ok, _ := cf.PathParent(); ok {
 		pc.Parent = d
 	}
 
-	if b, ok, err := cf.Bool("PathParentDouble"); ok {
+	if b, ok, err := cf.PathParentDouble(); ok && err == nil {
 		pc.ParentDouble = b
 	} else if err != nil {
 		errs = append(errs, fmt.Sprintf("PathParentDouble value invalid: %s", err))
 	}
 
-	if d, ok := cf.String("PathEscapeCharacter"); ok {
-		if len(d) != 1 {
-			errs = append(errs, fmt.Sprintf("PathEscapeCharacter %q invalid, must be 1 character", d))
-		} else {
-			pc.EscapeCharacter = d[0]
-		}
+	if c, ok, err := cf.PathEscapeCharacter(); ok && err == nil {
+		pc.EscapeCharacter = c
+	} else if err != nil {
+		errs = append(errs, fmt.Sprintf("PathEscapeCharacter value invalid: %s", err))
 	}
 
-	if b, ok, err := cf.Bool("PathKeepPreDelimiter"); ok {
-		pc.ParentDouble = b
+	if b, ok, err := cf.PathKeepPreDelimeter(); ok && err == nil {
+		pc.KeepPreDelimiter = b
 	} else if err != nil {
-		errs = append(errs, fmt.Sprintf("PathKeepPreDelimiter value invalid: %s", err))
+		errs = append(errs, fmt.Sprintf("PathKeepPreDelimeter value invalid: %s", err))
 	}
 
 	if len(errs) > 0 {
@@ -277,22 +277,6 @@ func ParseCapsBytes(name string, data []byte, flag ParseCapsFlag) (*CapsFile, er
 			start = pos + end
 			linetypLast = 0
 
-			switch k {
-			case "CapsFileVersion":
-				iv, err := strconv.ParseInt(v, 10, 0)
-				if err != nil {
-					return nil, err
-				}
-				file.version = int(iv)
-
-			case "ExpireCapsAfter":
-				iv, err := strconv.ParseInt(v, 10, 32) // 32-bit to prevent overflow
-				if err != nil {
-					return nil, err
-				}
-				file.expiresAfter = time.Duration(iv) * time.Second
-			}
-
 		case lineDot:
 			if len(line) != 1 || flag&CapsForbidDot != 0 {
 				return file, fmt.Errorf("gopher: caps file error at line %d: invalid key", lnum)
@@ -311,9 +295,51 @@ func ParseCapsBytes(name string, data []byte, flag ParseCapsFlag) (*CapsFile, er
 		return file, fmt.Errorf("gopher: premature end of caps file")
 	}
 
+	// Bad values are left for Validate() to report, rather than refusing the whole
+	// file; the cached value is left unset:
+	file.refresh()
+
 	return file, nil
 }
 
+// checkCachedKey reports whether v is a valid value for k, if k is one of the keys
+// whose value is cached on the CapsFile. Other keys are not checked.
+func checkCachedKey(k, v string) error {
+	switch strings.ToLower(k) {
+	case "capsversion", "capsfileversion":
+		_, err := parseInt(v)
+		return err
+	case "expirecapsafter":
+		_, err := parseCapsExpiry(v)
+		return err
+	}
+	return nil
+}
+
+// refresh rebuilds the values cached on the CapsFile. Aliases are looked up in the same
+// order as the typed getters, so Version() always agrees with CapsVersion().
+func (cf *CapsFile) refresh() {
+	cf.version, cf.expiresAfter = 0, 0
+	if v, ok, err := cf.CapsVersion(); ok && err == nil {
+		cf.version = v
+	}
+	if kv := cf.find("ExpireCapsAfter"); kv != nil {
+		if v, err := parseCapsExpiry(kv.Value); err == nil {
+			cf.expiresAfter = v
+		}
+	}
+}
+
+// parseCapsExpiry doesn't use parseDuration as we don't want to reject negative values
+// while parsing; Validate() will report those.
+func parseCapsExpiry(v string) (time.Duration, error) {
+	iv, err := strconv.ParseInt(v, 10, 32) // 32-bit to prevent overflow
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(iv) * time.Second, nil
+}
+
 func capsParseKV(line []byte) (k, v string, err error) {
 	index := bytes.IndexByte(line, '=')
 	if index < 0 {
@@ -327,10 +353,8 @@ func capsParseKV(line []byte) (k, v string, err error) {
 		return k, v, ErrCapsKeyValueInvalid
 	}
 
-	for _, b := range k {
-		if !((b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9')) {
-			return k, v, ErrCapsKeyValueInvalid
-		}
+	if !capsValidKey(k) {
+		return k, v, ErrCapsKeyValueInvalid
 	}
 
 	v = strings.TrimLeft(string(line[index+1:]), " \t")
@@ -338,6 +362,18 @@ func capsParseKV(line []byte) (k, v string, err error) {
 	return k, v, nil
 }
 
+func capsValidKey(k string) bool {
+	if len(k) == 0 {
+		return false
+	}
+	for _, b := range k {
+		if !((b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
 func dropCR(data []byte) []byte {
 	sz := len(data)
 	if len(data) > 0 && data[sz-1] == '\r' {
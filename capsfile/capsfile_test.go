@@ -1,10 +1,15 @@
 package capsfile
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
 )
 
 func TestParseCapsSeparateComments(t *testing.T) {
@@ -43,3 +48,295 @@ func TestParseCapsInvalidKV(t *testing.T) {
 		})
 	}
 }
+
+func TestCapsWriteToRoundTrip(t *testing.T) {
+	for idx, tc := range []string{
+		"CAPS",
+		"CAPS\n",
+		"CAPS\n\n",
+		"CAPS\n# foo\n\n# bar\n",
+		"CAPS\r\nCapsFileVersion=1\r\n\r\n# yep\r\nFoo = bar\r\n",
+		"CAPS\nFoo=bar",
+		"CAPS\nFoo=bar\n# trailing comment",
+		"CAPS\nFoo=bar\n  \t\n\nBar\t=\t  baz  \n.\n",
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			caps, err := ParseCapsBytes("file", []byte(tc), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			n, err := caps.WriteTo(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(n) != len(tc) {
+				t.Fatal(n, "!=", len(tc))
+			}
+			if buf.String() != tc {
+				t.Fatalf("%q != %q", buf.String(), tc)
+			}
+		})
+	}
+}
+
+func TestCapsSet(t *testing.T) {
+	for idx, tc := range []struct {
+		in, key, value, out string
+	}{
+		{"CAPS", "Foo", "bar", "CAPS\nFoo=bar\n"},
+		{"CAPS\n", "Foo", "bar", "CAPS\nFoo=bar\n"},
+		{"CAPS\n# yep\n", "Foo", "bar", "CAPS\n# yep\nFoo=bar\n"},
+		{"CAPS\n# yep", "Foo", "bar", "CAPS\n# yep\nFoo=bar\n"},
+		{"CAPS\r\n# yep\r\n", "Foo", "bar", "CAPS\r\n# yep\r\nFoo=bar\r\n"},
+		{"CAPS\nFoo=baz\n.\n", "Bar", "qux", "CAPS\nFoo=baz\nBar=qux\n.\n"},
+
+		{"CAPS\n# a\nFoo=baz\n# b\n", "Foo", "qux", "CAPS\n# a\nFoo=qux\n# b\n"},
+		{"CAPS\n# a\nFoo \t= baz\n# b\n", "foo", "qux", "CAPS\n# a\nFoo \t= qux\n# b\n"},
+		{"CAPS\r\nFoo=baz\r\n", "Foo", "qux", "CAPS\r\nFoo=qux\r\n"},
+		{"CAPS\nFoo=baz", "Foo", "", "CAPS\nFoo="},
+		{"CAPS\nFoo=1\nFoo=2\n", "Foo", "3", "CAPS\nFoo=1\nFoo=3\n"},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			caps, err := ParseCapsBytes("file", []byte(tc.in), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := caps.Set(tc.key, tc.value); err != nil {
+				t.Fatal(err)
+			}
+			if v, _ := caps.String(tc.key); v != tc.value {
+				t.Fatal(v, "!=", tc.value)
+			}
+
+			var buf bytes.Buffer
+			if _, err := caps.WriteTo(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tc.out {
+				t.Fatalf("%q != %q", buf.String(), tc.out)
+			}
+
+			back, err := ParseCapsBytes("file", buf.Bytes(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v, _ := back.String(tc.key); v != tc.value {
+				t.Fatal(v, "!=", tc.value)
+			}
+		})
+	}
+}
+
+func TestCapsSetInvalid(t *testing.T) {
+	caps := NewCapsFile("file")
+	if err := caps.Set("$foo", "bar"); !errors.Is(err, ErrCapsKeyValueInvalid) {
+		t.Fatal(err)
+	}
+	if err := caps.Set("foo", "bar\nbaz"); !errors.Is(err, ErrCapsKeyValueInvalid) {
+		t.Fatal(err)
+	}
+	if err := caps.Set("CapsFileVersion", "yep"); err == nil {
+		t.Fatal()
+	}
+	if len(caps.Entries) != 0 {
+		t.Fatal()
+	}
+}
+
+func TestCapsDelete(t *testing.T) {
+	in := "CAPS\n# a\nFoo=1\n# b\nBar=2\nfoo=3\n"
+	caps, err := ParseCapsBytes("file", []byte(in), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caps.Delete("FOO") {
+		t.Fatal()
+	}
+	if caps.Delete("FOO") {
+		t.Fatal()
+	}
+	if _, ok := caps.String("foo"); ok {
+		t.Fatal()
+	}
+
+	var buf bytes.Buffer
+	if _, err := caps.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "CAPS\n# a\n# b\nBar=2\n" {
+		t.Fatalf("%q", buf.String())
+	}
+}
+
+func TestCapsTypedGetters(t *testing.T) {
+	cf := strings.Join([]string{
+		`CAPS`,
+		`CapsVersion=1`,
+		`ExpireCapsAfter=3600`,
+		`PathDelimeter=:`,
+		`PathKeepPreDelimiter=TRUE`,
+		`ServerVersion=1.2.3`,
+		`DefaultEncoding=ascii`,
+		`ServerTLSPort=7443`,
+		`SupportsGopherIIbis=false`,
+	}, "\n")
+
+	caps, err := ParseCapsBytes("file", []byte(cf), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Version() != 1 {
+		t.Fatal(caps.Version())
+	}
+	if caps.ExpiresAfter() != time.Hour {
+		t.Fatal(caps.ExpiresAfter())
+	}
+	if caps.TLSPort() != 7443 {
+		t.Fatal(caps.TLSPort())
+	}
+	if caps.DefaultEncoding() != "ascii" {
+		t.Fatal(caps.DefaultEncoding())
+	}
+	if _, v := caps.Software(); v != "1.2.3" {
+		t.Fatal(v)
+	}
+	if s := caps.Supports(gopher.FeatureIIbis); s != gopher.FeatureUnsupported {
+		t.Fatal(s)
+	}
+	if s := caps.Supports(gopher.FeatureII); s != gopher.FeatureStatusUnknown {
+		t.Fatal(s)
+	}
+
+	pc, err := caps.PathConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.Delimiter != ":" || !pc.KeepPreDelimiter || pc.ParentDouble {
+		t.Fatal(pc)
+	}
+
+	if v, ok, err := caps.Int64("servertlsport"); !ok || err != nil || v != 7443 {
+		t.Fatal(v, ok, err)
+	}
+}
+
+func TestCapsValidate(t *testing.T) {
+	cf := strings.Join([]string{
+		`CAPS`,                   // 1
+		`CapsVersion=1`,          // 2
+		`# comment`,              // 3
+		``,                       // 4
+		`ExpireCapsAfter=-1`,     // 5
+		`PathEscapeCharacter=//`, // 6
+		`Quack=yep`,              // 7
+		`ServerAdmin=nope`,       // 8
+		`ServerTLSPort=0`,        // 9
+		`CapsFileVersion=2`,      // 10
+		`PathParentDouble=0`,     // 11
+	}, "\n")
+
+	caps, err := ParseCapsBytes("file", []byte(cf), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := caps.Validate()
+	var lines []int
+	for _, err := range errs {
+		lines = append(lines, err.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{5, 6, 7, 8, 9, 10}) {
+		t.Fatal(lines, errs)
+	}
+	if !errors.Is(errs[2], ErrUnknownKey) {
+		t.Fatal(errs[2])
+	}
+	if !errors.Is(errs[5], ErrDuplicateKey) {
+		t.Fatal(errs[5])
+	}
+
+	// The canonical key wins over the alias, as it does for CapsVersion():
+	if v, _, _ := caps.CapsVersion(); caps.Version() != 1 || v != 1 {
+		t.Fatal(caps.Version(), v)
+	}
+
+	caps.Delete("Quack")
+	caps.Delete("CapsVersion")
+	if caps.Version() != 2 {
+		t.Fatal("version not rebuilt from remaining alias", caps.Version())
+	}
+	caps.Set("CapsVersion", "1")
+	caps.Delete("CapsFileVersion")
+	if caps.Version() != 1 {
+		t.Fatal(caps.Version())
+	}
+	caps.Set("ExpireCapsAfter", "60")
+	caps.Set("PathEscapeCharacter", `\`)
+	caps.Set("ServerAdmin", "gopher@example.com")
+	caps.Set("ServerTLSPort", "7443")
+	if errs := caps.Validate(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+}
+
+func TestCapsVersionAliasOrder(t *testing.T) {
+	// Whichever order they appear in, CapsVersion wins, and setting the alias doesn't
+	// change that:
+	for idx, tc := range []string{
+		"CAPS\nCapsVersion=1\nCapsFileVersion=2\n",
+		"CAPS\nCapsFileVersion=2\nCapsVersion=1\n",
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			caps, err := ParseCapsBytes("file", []byte(tc), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v, _, _ := caps.CapsVersion(); caps.Version() != 1 || v != 1 {
+				t.Fatal(caps.Version(), v)
+			}
+			if err := caps.Set("CapsFileVersion", "3"); err != nil {
+				t.Fatal(err)
+			}
+			if v, _, _ := caps.CapsVersion(); caps.Version() != 1 || v != 1 {
+				t.Fatal(caps.Version(), v)
+			}
+		})
+	}
+}
+
+func TestCapsPathDelimeterString(t *testing.T) {
+	caps, err := ParseCapsBytes("file", []byte("CAPS\nPathDelimeter=::\n"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := caps.PathConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.Delimiter != "::" {
+		t.Fatal(pc.Delimiter)
+	}
+	if errs := caps.Validate(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+}
+
+func TestCapsBadCachedValues(t *testing.T) {
+	caps, err := ParseCapsBytes("file", []byte("CAPS\nCapsVersion=one\nExpireCapsAfter=soon\nServerSoftware=yep\n"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Version() != 0 || caps.ExpiresAfter() != 0 {
+		t.Fatal(caps.Version(), caps.ExpiresAfter())
+	}
+
+	errs := caps.Validate()
+	if len(errs) != 2 || errs[0].Line != 2 || errs[1].Line != 3 {
+		t.Fatal(errs)
+	}
+
+	if err := caps.Set("CapsVersion", "two"); err == nil {
+		t.Fatal()
+	}
+}
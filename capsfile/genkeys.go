@@ -0,0 +1,142 @@
+//+build ignore
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strconv"
+)
+
+// keys is the schema of all known caps.txt keys, from which keys_gen.go is built. If you
+// change this, you must run 'go generate'.
+//
+// Most of these are described in the GopherII draft:
+// https://tools.ietf.org/html/draft-matavka-gopher-ii-03
+var keys = []keySpec{
+	{"CapsVersion", "KeyInt", []string{"CapsFileVersion"},
+		"Version of the caps file format."},
+	{"ExpireCapsAfter", "KeyDuration", nil,
+		"Number of seconds a client may cache the caps file for."},
+
+	// XXX: The caps key is 'PathDelimeter', which is a real-world common-use misspelling
+	// a-la 'HTTP Referer':
+	{"PathDelimeter", "KeyString", []string{"PathDelimiter"},
+		"String separating path segments in selectors."},
+	{"PathIdentity", "KeyString", nil,
+		"Path shorthand for 'this directory'."},
+	{"PathParent", "KeyString", nil,
+		"Path shorthand for 'the parent directory'."},
+	{"PathParentDouble", "KeyBool", nil,
+		"Two consecutive delimiters refer to the parent directory (pre OS X Macs)."},
+	{"PathEscapeCharacter", "KeyPathChar", nil,
+		"Character used to escape delimiters in selectors."},
+	{"PathKeepPreDelimeter", "KeyBool", []string{"PathKeepPreDelimiter"},
+		"Clients should not cut everything up to the first path delimiter."},
+
+	{"ServerSoftware", "KeyString", nil,
+		"Name of the server software."},
+	{"ServerSoftwareVersion", "KeyString", []string{"ServerVersion"},
+		"Version of the server software."},
+	{"ServerArchitecture", "KeyString", nil,
+		"Architecture or operating system of the server."},
+	{"ServerDescription", "KeyString", nil,
+		"Free-form description of the server."},
+	{"ServerGeolocationString", "KeyGeolocation", nil,
+		"Free-form description of the server's physical location."},
+	{"ServerAdmin", "KeyEmail", nil,
+		"Email address of the server's administrator."},
+	{"ServerDefaultEncoding", "KeyEncoding", []string{"DefaultEncoding"},
+		"Default text encoding for item types 0 and 1."},
+	{"ServerSupportsStdinScripts", "KeyBool", nil,
+		"Server passes request data blocks to scripts on stdin."},
+	{"ServerTLSPort", "KeyPort", nil,
+		"Port on which the server accepts TLS connections."},
+
+	{"SupportsGopherII", "KeyBool", nil,
+		"Server understands GopherII queries."},
+	{"SupportsGopherIIbis", "KeyBool", nil,
+		"Server responds to GopherIIbis metadata queries."},
+	{"SupportsGopherPlusAsk", "KeyBool", nil,
+		"Server supports Gopher+ ASK forms."},
+}
+
+type keySpec struct {
+	name    string
+	typ     string
+	aliases []string
+	doc     string
+}
+
+var keyTypes = map[string]struct {
+	name   string
+	goType string
+	parse  string
+}{
+	"KeyString":      {"string", "string", "parseString"},
+	"KeyBool":        {"bool", "bool", "parseBool"},
+	"KeyInt":         {"int", "int", "parseInt"},
+	"KeyPort":        {"port", "int", "parsePort"},
+	"KeyDuration":    {"duration", "time.Duration", "parseDuration"},
+	"KeyPathChar":    {"path char", "byte", "parsePathChar"},
+	"KeyEncoding":    {"encoding", "string", "parseEncoding"},
+	"KeyGeolocation": {"geolocation", "string", "parseGeolocation"},
+	"KeyEmail":       {"email", "string", "parseEmail"},
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by genkeys.go; DO NOT EDIT.\n\n")
+	buf.WriteString("package capsfile\n\n")
+	buf.WriteString("import \"time\"\n\n")
+
+	buf.WriteString("// Keys is the schema of all known caps.txt keys.\n")
+	buf.WriteString("var Keys = []KeySpec{\n")
+	for _, spec := range keys {
+		if _, ok := keyTypes[spec.typ]; !ok {
+			return fmt.Errorf("unknown type %s for key %q", spec.typ, spec.name)
+		}
+		fmt.Fprintf(&buf, "\t{Name: %q, Type: %s, ", spec.name, spec.typ)
+		if len(spec.aliases) > 0 {
+			fmt.Fprintf(&buf, "Aliases: %#v, ", spec.aliases)
+		}
+		fmt.Fprintf(&buf, "Doc: %q},\n", spec.doc)
+	}
+	buf.WriteString("}\n\n")
+
+	for _, spec := range keys {
+		kt := keyTypes[spec.typ]
+
+		names := strconv.Quote(spec.name)
+		for _, alias := range spec.aliases {
+			names += ", " + strconv.Quote(alias)
+		}
+
+		fmt.Fprintf(&buf, "// %s returns the %s value of the '%s' key.\n", spec.name, kt.name, spec.name)
+		fmt.Fprintf(&buf, "// %s\n", spec.doc)
+		if len(spec.aliases) > 0 {
+			fmt.Fprintf(&buf, "//\n// Also accepts: %s\n", names[len(strconv.Quote(spec.name))+2:])
+		}
+		fmt.Fprintf(&buf, "func (cf *CapsFile) %s() (v %s, ok bool, err error) {\n", spec.name, kt.goType)
+		fmt.Fprintf(&buf, "\tkv := cf.find(%s)\n", names)
+		fmt.Fprintf(&buf, "\tif kv == nil {\n\t\treturn v, false, nil\n\t}\n")
+		fmt.Fprintf(&buf, "\tv, err = %s(kv.Value)\n", kt.parse)
+		fmt.Fprintf(&buf, "\treturn v, true, err\n")
+		fmt.Fprintf(&buf, "}\n\n")
+	}
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile("keys_gen.go", out, 0644)
+}
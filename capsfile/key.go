@@ -1,8 +1,243 @@
 package capsfile
 
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:generate go run genkeys.go
+
+type KeyType int
+
 const (
-	capKeyGopherIIbis   = "SupportsGopherIIbis"
-	capKeyGopherII      = "SupportsGopherII"
-	capKeyGopherPlusAsk = "SupportsGopherPlusAsk"
-	capKeyTLSPort       = "ServerTLSPort"
+	KeyString KeyType = iota + 1
+	KeyBool
+	KeyInt
+	KeyPort
+	KeyDuration    // Whole number of seconds
+	KeyPathChar    // Exactly one character
+	KeyEncoding    // Character set name, i.e. 'UTF-8', 'ascii'
+	KeyGeolocation // Free-form location string, i.e. 'Sydney, Australia'
+	KeyEmail
+)
+
+var keyTypeNames = map[KeyType]string{
+	KeyString:      "string",
+	KeyBool:        "bool",
+	KeyInt:         "int",
+	KeyPort:        "port",
+	KeyDuration:    "duration",
+	KeyPathChar:    "path char",
+	KeyEncoding:    "encoding",
+	KeyGeolocation: "geolocation",
+	KeyEmail:       "email",
+}
+
+func (t KeyType) String() string {
+	if s, ok := keyTypeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("KeyType(%d)", t)
+}
+
+// KeySpec describes a known caps.txt key. The schema of all known keys is available in
+// Keys, which is generated along with a typed getter for each key by genkeys.go.
+type KeySpec struct {
+	Name string
+	Type KeyType
+
+	// Aliases are alternative spellings seen in the wild, or used by earlier versions of
+	// this library. The canonical Name always takes precedence over an alias.
+	Aliases []string
+
+	Doc string
+}
+
+var keyIndex = map[string]*KeySpec{}
+
+func init() {
+	for i := range Keys {
+		spec := &Keys[i]
+		keyIndex[strings.ToLower(spec.Name)] = spec
+		for _, alias := range spec.Aliases {
+			keyIndex[strings.ToLower(alias)] = spec
+		}
+	}
+}
+
+// LookupKey finds the KeySpec for a key or any of its aliases. Keys are not case
+// sensitive.
+func LookupKey(key string) (spec *KeySpec, ok bool) {
+	spec, ok = keyIndex[strings.ToLower(key)]
+	return spec, ok
+}
+
+// Validate parses v according to the KeySpec's type.
+func (spec *KeySpec) Validate(v string) error {
+	var err error
+	switch spec.Type {
+	case KeyString:
+		_, err = parseString(v)
+	case KeyBool:
+		_, err = parseBool(v)
+	case KeyInt:
+		_, err = parseInt(v)
+	case KeyPort:
+		_, err = parsePort(v)
+	case KeyDuration:
+		_, err = parseDuration(v)
+	case KeyPathChar:
+		_, err = parsePathChar(v)
+	case KeyEncoding:
+		_, err = parseEncoding(v)
+	case KeyGeolocation:
+		_, err = parseGeolocation(v)
+	case KeyEmail:
+		_, err = parseEmail(v)
+	default:
+		err = fmt.Errorf("unknown key type %d", spec.Type)
+	}
+	return err
+}
+
+var (
+	ErrUnknownKey   = errors.New("caps: unknown key")
+	ErrDuplicateKey = errors.New("caps: duplicate key")
 )
+
+// ValidationError describes a problem found with a single key by CapsFile.Validate().
+type ValidationError struct {
+	Line int
+	Key  string
+	Err  error
+}
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("gopher: caps key %q at line %d invalid: %v", e.Key, e.Line, e.Err)
+}
+
+// Validate checks every key in the file against the schema in Keys. Unknown keys,
+// duplicate keys (including aliases of the same key) and values that do not match the
+// key's type are reported. Returns nil if no problems were found.
+func (cf *CapsFile) Validate() []*ValidationError {
+	var errs []*ValidationError
+	var seen = map[*KeySpec]bool{}
+
+	// Lines are counted from the entries rather than stored at parse time so they
+	// remain correct after calls to Set() or Delete(). The magic is on line 1.
+	var line = 1
+
+	for _, e := range cf.Entries {
+		raw := capEntryBytes(e)
+
+		if kv, ok := e.(*CapKeyValue); ok {
+			spec, ok := LookupKey(kv.Key)
+			if !ok {
+				errs = append(errs, &ValidationError{Line: line, Key: kv.Key, Err: ErrUnknownKey})
+
+			} else {
+				if seen[spec] {
+					errs = append(errs, &ValidationError{Line: line, Key: kv.Key, Err: ErrDuplicateKey})
+				}
+				seen[spec] = true
+
+				if err := spec.Validate(kv.Value); err != nil {
+					errs = append(errs, &ValidationError{Line: line, Key: kv.Key, Err: err})
+				}
+			}
+		}
+
+		line += strings.Count(string(raw), "\n")
+	}
+
+	return errs
+}
+
+// find returns the first key found from the list of names; names should contain
+// the canonical key first, followed by its aliases.
+func (cf *CapsFile) find(names ...string) *CapKeyValue {
+	for _, name := range names {
+		if kv := cf.keyIndex[strings.ToLower(name)]; kv != nil {
+			return kv
+		}
+	}
+	return nil
+}
+
+func parseString(v string) (string, error) {
+	return v, nil
+}
+
+func parseBool(v string) (bool, error) {
+	return strconv.ParseBool(v)
+}
+
+func parseInt(v string) (int, error) {
+	iv, err := strconv.ParseInt(v, 10, 0)
+	return int(iv), err
+}
+
+func parsePort(v string) (int, error) {
+	iv, err := strconv.ParseUint(v, 10, 16)
+	if err != nil {
+		return 0, err
+	}
+	if iv == 0 {
+		return 0, fmt.Errorf("port must not be 0")
+	}
+	return int(iv), nil
+}
+
+func parseDuration(v string) (time.Duration, error) {
+	iv, err := strconv.ParseInt(v, 10, 32) // 32-bit to prevent overflow
+	if err != nil {
+		return 0, err
+	}
+	if iv < 0 {
+		return 0, fmt.Errorf("duration %d must not be negative", iv)
+	}
+	return time.Duration(iv) * time.Second, nil
+}
+
+func parsePathChar(v string) (byte, error) {
+	if len(v) != 1 {
+		return 0, fmt.Errorf("%q invalid, must be 1 character", v)
+	}
+	return v[0], nil
+}
+
+func parseEncoding(v string) (string, error) {
+	// Character set names, as per RFC 2978:
+	if len(v) == 0 || len(v) > 40 {
+		return "", fmt.Errorf("encoding %q invalid", v)
+	}
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if !((c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == ':' || c == '+') {
+			return "", fmt.Errorf("encoding %q invalid", v)
+		}
+	}
+	return v, nil
+}
+
+func parseGeolocation(v string) (string, error) {
+	if strings.TrimSpace(v) == "" {
+		return "", fmt.Errorf("geolocation must not be empty")
+	}
+	return v, nil
+}
+
+func parseEmail(v string) (string, error) {
+	addr, err := mail.ParseAddress(v)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
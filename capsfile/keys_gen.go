@@ -0,0 +1,259 @@
+// Code generated by genkeys.go; DO NOT EDIT.
+
+package capsfile
+
+import "time"
+
+// Keys is the schema of all known caps.txt keys.
+var Keys = []KeySpec{
+	{Name: "CapsVersion", Type: KeyInt, Aliases: []string{"CapsFileVersion"}, Doc: "Version of the caps file format."},
+	{Name: "ExpireCapsAfter", Type: KeyDuration, Doc: "Number of seconds a client may cache the caps file for."},
+	{Name: "PathDelimeter", Type: KeyString, Aliases: []string{"PathDelimiter"}, Doc: "String separating path segments in selectors."},
+	{Name: "PathIdentity", Type: KeyString, Doc: "Path shorthand for 'this directory'."},
+	{Name: "PathParent", Type: KeyString, Doc: "Path shorthand for 'the parent directory'."},
+	{Name: "PathParentDouble", Type: KeyBool, Doc: "Two consecutive delimiters refer to the parent directory (pre OS X Macs)."},
+	{Name: "PathEscapeCharacter", Type: KeyPathChar, Doc: "Character used to escape delimiters in selectors."},
+	{Name: "PathKeepPreDelimeter", Type: KeyBool, Aliases: []string{"PathKeepPreDelimiter"}, Doc: "Clients should not cut everything up to the first path delimiter."},
+	{Name: "ServerSoftware", Type: KeyString, Doc: "Name of the server software."},
+	{Name: "ServerSoftwareVersion", Type: KeyString, Aliases: []string{"ServerVersion"}, Doc: "Version of the server software."},
+	{Name: "ServerArchitecture", Type: KeyString, Doc: "Architecture or operating system of the server."},
+	{Name: "ServerDescription", Type: KeyString, Doc: "Free-form description of the server."},
+	{Name: "ServerGeolocationString", Type: KeyGeolocation, Doc: "Free-form description of the server's physical location."},
+	{Name: "ServerAdmin", Type: KeyEmail, Doc: "Email address of the server's administrator."},
+	{Name: "ServerDefaultEncoding", Type: KeyEncoding, Aliases: []string{"DefaultEncoding"}, Doc: "Default text encoding for item types 0 and 1."},
+	{Name: "ServerSupportsStdinScripts", Type: KeyBool, Doc: "Server passes request data blocks to scripts on stdin."},
+	{Name: "ServerTLSPort", Type: KeyPort, Doc: "Port on which the server accepts TLS connections."},
+	{Name: "SupportsGopherII", Type: KeyBool, Doc: "Server understands GopherII queries."},
+	{Name: "SupportsGopherIIbis", Type: KeyBool, Doc: "Server responds to GopherIIbis metadata queries."},
+	{Name: "SupportsGopherPlusAsk", Type: KeyBool, Doc: "Server supports Gopher+ ASK forms."},
+}
+
+// CapsVersion returns the int value of the 'CapsVersion' key.
+// Version of the caps file format.
+//
+// Also accepts: "CapsFileVersion"
+func (cf *CapsFile) CapsVersion() (v int, ok bool, err error) {
+	kv := cf.find("CapsVersion", "CapsFileVersion")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseInt(kv.Value)
+	return v, true, err
+}
+
+// ExpireCapsAfter returns the duration value of the 'ExpireCapsAfter' key.
+// Number of seconds a client may cache the caps file for.
+func (cf *CapsFile) ExpireCapsAfter() (v time.Duration, ok bool, err error) {
+	kv := cf.find("ExpireCapsAfter")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseDuration(kv.Value)
+	return v, true, err
+}
+
+// PathDelimeter returns the string value of the 'PathDelimeter' key.
+// String separating path segments in selectors.
+//
+// Also accepts: "PathDelimiter"
+func (cf *CapsFile) PathDelimeter() (v string, ok bool, err error) {
+	kv := cf.find("PathDelimeter", "PathDelimiter")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseString(kv.Value)
+	return v, true, err
+}
+
+// PathIdentity returns the string value of the 'PathIdentity' key.
+// Path shorthand for 'this directory'.
+func (cf *CapsFile) PathIdentity() (v string, ok bool, err error) {
+	kv := cf.find("PathIdentity")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseString(kv.Value)
+	return v, true, err
+}
+
+// PathParent returns the string value of the 'PathParent' key.
+// Path shorthand for 'the parent directory'.
+func (cf *CapsFile) PathParent() (v string, ok bool, err error) {
+	kv := cf.find("PathParent")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseString(kv.Value)
+	return v, true, err
+}
+
+// PathParentDouble returns the bool value of the 'PathParentDouble' key.
+// Two consecutive delimiters refer to the parent directory (pre OS X Macs).
+func (cf *CapsFile) PathParentDouble() (v bool, ok bool, err error) {
+	kv := cf.find("PathParentDouble")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseBool(kv.Value)
+	return v, true, err
+}
+
+// PathEscapeCharacter returns the path char value of the 'PathEscapeCharacter' key.
+// Character used to escape delimiters in selectors.
+func (cf *CapsFile) PathEscapeCharacter() (v byte, ok bool, err error) {
+	kv := cf.find("PathEscapeCharacter")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parsePathChar(kv.Value)
+	return v, true, err
+}
+
+// PathKeepPreDelimeter returns the bool value of the 'PathKeepPreDelimeter' key.
+// Clients should not cut everything up to the first path delimiter.
+//
+// Also accepts: "PathKeepPreDelimiter"
+func (cf *CapsFile) PathKeepPreDelimeter() (v bool, ok bool, err error) {
+	kv := cf.find("PathKeepPreDelimeter", "PathKeepPreDelimiter")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseBool(kv.Value)
+	return v, true, err
+}
+
+// ServerSoftware returns the string value of the 'ServerSoftware' key.
+// Name of the server software.
+func (cf *CapsFile) ServerSoftware() (v string, ok bool, err error) {
+	kv := cf.find("ServerSoftware")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseString(kv.Value)
+	return v, true, err
+}
+
+// ServerSoftwareVersion returns the string value of the 'ServerSoftwareVersion' key.
+// Version of the server software.
+//
+// Also accepts: "ServerVersion"
+func (cf *CapsFile) ServerSoftwareVersion() (v string, ok bool, err error) {
+	kv := cf.find("ServerSoftwareVersion", "ServerVersion")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseString(kv.Value)
+	return v, true, err
+}
+
+// ServerArchitecture returns the string value of the 'ServerArchitecture' key.
+// Architecture or operating system of the server.
+func (cf *CapsFile) ServerArchitecture() (v string, ok bool, err error) {
+	kv := cf.find("ServerArchitecture")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseString(kv.Value)
+	return v, true, err
+}
+
+// ServerDescription returns the string value of the 'ServerDescription' key.
+// Free-form description of the server.
+func (cf *CapsFile) ServerDescription() (v string, ok bool, err error) {
+	kv := cf.find("ServerDescription")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseString(kv.Value)
+	return v, true, err
+}
+
+// ServerGeolocationString returns the geolocation value of the 'ServerGeolocationString' key.
+// Free-form description of the server's physical location.
+func (cf *CapsFile) ServerGeolocationString() (v string, ok bool, err error) {
+	kv := cf.find("ServerGeolocationString")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseGeolocation(kv.Value)
+	return v, true, err
+}
+
+// ServerAdmin returns the email value of the 'ServerAdmin' key.
+// Email address of the server's administrator.
+func (cf *CapsFile) ServerAdmin() (v string, ok bool, err error) {
+	kv := cf.find("ServerAdmin")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseEmail(kv.Value)
+	return v, true, err
+}
+
+// ServerDefaultEncoding returns the encoding value of the 'ServerDefaultEncoding' key.
+// Default text encoding for item types 0 and 1.
+//
+// Also accepts: "DefaultEncoding"
+func (cf *CapsFile) ServerDefaultEncoding() (v string, ok bool, err error) {
+	kv := cf.find("ServerDefaultEncoding", "DefaultEncoding")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseEncoding(kv.Value)
+	return v, true, err
+}
+
+// ServerSupportsStdinScripts returns the bool value of the 'ServerSupportsStdinScripts' key.
+// Server passes request data blocks to scripts on stdin.
+func (cf *CapsFile) ServerSupportsStdinScripts() (v bool, ok bool, err error) {
+	kv := cf.find("ServerSupportsStdinScripts")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseBool(kv.Value)
+	return v, true, err
+}
+
+// ServerTLSPort returns the port value of the 'ServerTLSPort' key.
+// Port on which the server accepts TLS connections.
+func (cf *CapsFile) ServerTLSPort() (v int, ok bool, err error) {
+	kv := cf.find("ServerTLSPort")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parsePort(kv.Value)
+	return v, true, err
+}
+
+// SupportsGopherII returns the bool value of the 'SupportsGopherII' key.
+// Server understands GopherII queries.
+func (cf *CapsFile) SupportsGopherII() (v bool, ok bool, err error) {
+	kv := cf.find("SupportsGopherII")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseBool(kv.Value)
+	return v, true, err
+}
+
+// SupportsGopherIIbis returns the bool value of the 'SupportsGopherIIbis' key.
+// Server responds to GopherIIbis metadata queries.
+func (cf *CapsFile) SupportsGopherIIbis() (v bool, ok bool, err error) {
+	kv := cf.find("SupportsGopherIIbis")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseBool(kv.Value)
+	return v, true, err
+}
+
+// SupportsGopherPlusAsk returns the bool value of the 'SupportsGopherPlusAsk' key.
+// Server supports Gopher+ ASK forms.
+func (cf *CapsFile) SupportsGopherPlusAsk() (v bool, ok bool, err error) {
+	kv := cf.find("SupportsGopherPlusAsk")
+	if kv == nil {
+		return v, false, nil
+	}
+	v, err = parseBool(kv.Value)
+	return v, true, err
+}
@@ -0,0 +1,176 @@
+package capsfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var _ io.WriterTo = &CapsFile{}
+
+// WriteTo writes the caps file to w. If the CapsFile was parsed and has not been
+// modified, the output is identical to the input.
+func (cf *CapsFile) WriteTo(w io.Writer) (n int64, err error) {
+	wn, err := w.Write(tokCapsMagic)
+	n += int64(wn)
+	if err != nil {
+		return n, err
+	}
+
+	for _, e := range cf.Entries {
+		wn, err = w.Write(capEntryBytes(e))
+		n += int64(wn)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// Set the value for a key. If the key already exists, the last instance of the key
+// in the file is updated in place, preserving the original spelling of the key and the
+// whitespace surrounding the '='. If the key does not exist, it is appended to the end
+// of the file.
+func (cf *CapsFile) Set(key, value string) error {
+	if !capsValidKey(key) {
+		return fmt.Errorf("gopher: caps key %q invalid: %w", key, ErrCapsKeyValueInvalid)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("gopher: caps value for key %q contains newline: %w", key, ErrCapsKeyValueInvalid)
+	}
+
+	// The key is validated before we touch anything so the file isn't left in a
+	// half-edited state:
+	if err := checkCachedKey(key, value); err != nil {
+		return fmt.Errorf("gopher: caps value for key %q invalid: %w", key, err)
+	}
+	defer cf.refresh()
+
+	if kv := cf.keyIndex[strings.ToLower(key)]; kv != nil {
+		line := dropLineEnding(kv.Raw)
+		prefix := line[:len(line)-len(kv.Value)]
+		ending := kv.Raw[len(line):]
+
+		raw := make([]byte, 0, len(prefix)+len(value)+len(ending))
+		raw = append(raw, prefix...)
+		raw = append(raw, value...)
+		raw = append(raw, ending...)
+
+		kv.Value, kv.Raw = value, raw
+		return nil
+	}
+
+	nl := cf.lineEnding()
+
+	// The last entry may not have a trailing newline, or there may be no entries at
+	// all, in which case we need to separate ourselves from the magic:
+	if len(cf.Entries) == 0 {
+		cf.Entries = append(cf.Entries, CapWsp(nl))
+	} else {
+		last := len(cf.Entries) - 1
+		if raw := capEntryBytes(cf.Entries[last]); !bytes.HasSuffix(raw, []byte{'\n'}) {
+			cf.Entries[last] = capEntryWithEnding(cf.Entries[last], nl)
+		}
+	}
+
+	kv := &CapKeyValue{Key: key, Value: value, Raw: []byte(key + "=" + value + nl)}
+
+	// Keep dodgy dot terminators at the end of the file, if they are present:
+	at := len(cf.Entries)
+	if _, ok := cf.Entries[at-1].(CapDot); ok {
+		at--
+	}
+	cf.Entries = append(cf.Entries, nil)
+	copy(cf.Entries[at+1:], cf.Entries[at:])
+	cf.Entries[at] = kv
+
+	cf.keyIndex[strings.ToLower(key)] = kv
+	return nil
+}
+
+// Delete removes all instances of a key from the file. Comments and whitespace
+// surrounding the key are left intact. Returns false if the key was not found.
+func (cf *CapsFile) Delete(key string) (found bool) {
+	lkey := strings.ToLower(key)
+	if cf.keyIndex[lkey] == nil {
+		return false
+	}
+
+	out := cf.Entries[:0]
+	for _, e := range cf.Entries {
+		if kv, ok := e.(*CapKeyValue); ok && strings.ToLower(kv.Key) == lkey {
+			continue
+		}
+		out = append(out, e)
+	}
+	for i := len(out); i < len(cf.Entries); i++ {
+		cf.Entries[i] = nil
+	}
+	cf.Entries = out
+	delete(cf.keyIndex, lkey)
+
+	// The cached value may now come from an alias that is still in the file:
+	cf.refresh()
+
+	return true
+}
+
+// lineEnding guesses the line ending used by the file from the first entry that has
+// one. If no line endings are found, LF is presumed.
+func (cf *CapsFile) lineEnding() string {
+	for _, e := range cf.Entries {
+		raw := capEntryBytes(e)
+		if idx := bytes.IndexByte(raw, '\n'); idx >= 0 {
+			if idx > 0 && raw[idx-1] == '\r' {
+				return "\r\n"
+			}
+			return "\n"
+		}
+	}
+	return "\n"
+}
+
+func capEntryBytes(e CapEntry) []byte {
+	switch e := e.(type) {
+	case *CapKeyValue:
+		return e.Raw
+	case CapComment:
+		return e
+	case CapWsp:
+		return e
+	case CapDot:
+		return e
+	default:
+		panic(fmt.Errorf("gopher: unknown caps entry %T", e))
+	}
+}
+
+func capEntryWithEnding(e CapEntry, nl string) CapEntry {
+	raw := capEntryBytes(e)
+	out := make([]byte, 0, len(raw)+len(nl))
+	out = append(append(out, raw...), nl...)
+
+	switch e := e.(type) {
+	case *CapKeyValue:
+		e.Raw = out
+		return e
+	case CapComment:
+		return CapComment(out)
+	case CapWsp:
+		return CapWsp(out)
+	case CapDot:
+		return CapDot(out)
+	default:
+		panic(fmt.Errorf("gopher: unknown caps entry %T", e))
+	}
+}
+
+func dropLineEnding(data []byte) []byte {
+	sz := len(data)
+	if sz > 0 && data[sz-1] == '\n' {
+		sz--
+	}
+	return dropCR(data[:sz])
+}
@@ -0,0 +1,115 @@
+// Command gopherconform checks a gopher server for conformance with the protocol, and
+// common expectations of clients:
+//
+//	gopherconform [options] <host>[:<port>]
+//
+// A result is printed for each check, with an explanation. The exit status is 1 if
+// any check failed.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shabbyrobe/furlib/conformance"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+var errFailed = errors.New("")
+
+func main() {
+	if err := run(); errors.Is(err, errFailed) {
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func run() error {
+	var checker conformance.Checker
+	var only string
+	var list, verify bool
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [options] <host>[:<port>]\n\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&checker.TextSelector, "text", "", "Selector of a text item to check; if empty, the first on the root menu is used")
+	fs.IntVar(&checker.RequestSizeLimit, "limit", gopher.DefaultRequestSizeLimit, "Selector size limit the server is expected to enforce, including the CRLF")
+	fs.DurationVar(&checker.Timeout, "timeout", conformance.DefaultTimeout, "Maximum time to wait for each response")
+	fs.DurationVar(&checker.IdleTimeout, "idle", conformance.DefaultIdleTimeout, "Maximum time the server may wait for an incomplete selector")
+	fs.StringVar(&only, "run", "", "Comma separated list of checks to run; if empty, all are run")
+	fs.BoolVar(&list, "list", false, "List the checks and exit")
+	fs.BoolVar(&verify, "verify", false, "Verify the server's TLS certificate")
+	fs.Parse(os.Args[1:])
+
+	if list {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, check := range conformance.Checks {
+			fmt.Fprintf(tw, "%s\t%s\n", check.Name, check.Description)
+		}
+		return tw.Flush()
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("gopherconform: expected one address")
+	}
+	checker.Addr = fs.Arg(0)
+	if _, _, err := net.SplitHostPort(checker.Addr); err != nil {
+		checker.Addr = net.JoinHostPort(checker.Addr, "70")
+	}
+	if verify {
+		host, _, _ := net.SplitHostPort(checker.Addr)
+		checker.TLSConfig = &tls.Config{ServerName: host}
+	}
+
+	checks, err := selectChecks(only)
+	if err != nil {
+		return err
+	}
+
+	results := checker.Run(context.Background(), checks...)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Outcome, result.Check, result.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if conformance.Failed(results) {
+		return errFailed
+	}
+	return nil
+}
+
+func selectChecks(only string) ([]conformance.Check, error) {
+	if only == "" {
+		return conformance.Checks, nil
+	}
+
+	var checks []conformance.Check
+next:
+	for _, name := range strings.Split(only, ",") {
+		name = strings.TrimSpace(name)
+		for _, check := range conformance.Checks {
+			if check.Name == name {
+				checks = append(checks, check)
+				continue next
+			}
+		}
+		return nil, fmt.Errorf("gopherconform: unknown check %q; use -list to see them", name)
+	}
+	return checks, nil
+}
@@ -0,0 +1,228 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultIdleTimeout = 30 * time.Second
+
+	// Responses are truncated to this many bytes. It only needs to be big enough for
+	// menus and text items; the checks don't fetch anything else.
+	maxResponseSize = 1 << 20
+)
+
+// Checker runs conformance checks against the gopher server at Addr. It speaks the
+// protocol directly rather than using a gopher.Client, so it sees exactly what the
+// server sends.
+type Checker struct {
+	// Addr of the server, i.e. 'localhost:70'.
+	Addr string
+
+	// Selector of a text item to use for the text checks. If empty, the first text
+	// item on the server's root menu is used.
+	TextSelector string
+
+	// The selector size limit the server is expected to enforce. Selectors up to this
+	// size must be served, and larger ones must be refused. If zero,
+	// gopher.DefaultRequestSizeLimit is expected.
+	RequestSizeLimit int
+
+	// Maximum time to wait for each response. If zero, DefaultTimeout is used.
+	Timeout time.Duration
+
+	// Maximum time the server may wait for a client that doesn't finish sending its
+	// selector before it hangs up. If zero, DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	// TLSConfig is used to negotiate TLS. If nil, the server's certificate is not
+	// verified, as the check is only concerned with whether TLS can be negotiated.
+	TLSConfig *tls.Config
+}
+
+// Run runs checks against the server, in order, and returns a Result for each. If no
+// checks are given, all Checks are run.
+func (c *Checker) Run(ctx context.Context, checks ...Check) []Result {
+	if len(checks) == 0 {
+		checks = Checks
+	}
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		if err := ctx.Err(); err != nil {
+			results = append(results, Result{Check: check.Name, Outcome: Skip, Detail: err.Error()})
+			continue
+		}
+		result := check.Func(ctx, c)
+		result.Check = check.Name
+		results = append(results, result)
+	}
+	return results
+}
+
+func (c *Checker) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (c *Checker) idleTimeout() time.Duration {
+	if c.IdleTimeout > 0 {
+		return c.IdleTimeout
+	}
+	return DefaultIdleTimeout
+}
+
+func (c *Checker) requestSizeLimit() int {
+	if c.RequestSizeLimit > 0 {
+		return c.RequestSizeLimit
+	}
+	return gopher.DefaultRequestSizeLimit
+}
+
+func (c *Checker) tlsConfig() *tls.Config {
+	if c.TLSConfig != nil {
+		return c.TLSConfig
+	}
+	host, _, _ := net.SplitHostPort(c.Addr)
+	return &tls.Config{ServerName: host, InsecureSkipVerify: true}
+}
+
+func (c *Checker) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("conformance: could not connect to %s: %w", c.Addr, err)
+	}
+	return conn, nil
+}
+
+// exchange sends rq to the server and reads the response until the server closes the
+// connection. If the response was read but the connection was then reset, as servers
+// are entitled to do when the client sent more than they read, the response is
+// returned without an error.
+func (c *Checker) exchange(ctx context.Context, rq string) ([]byte, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return c.exchangeConn(ctx, conn, rq)
+}
+
+func (c *Checker) exchangeConn(ctx context.Context, conn net.Conn, rq string) ([]byte, error) {
+	conn.SetDeadline(c.deadline(ctx, c.timeout()))
+
+	if _, err := io.WriteString(conn, rq); err != nil && !isReset(err) {
+		return nil, fmt.Errorf("conformance: request failed: %w", err)
+	}
+
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(io.LimitReader(conn, maxResponseSize))
+	if err != nil {
+		if isTimeout(err) {
+			return buf.Bytes(), fmt.Errorf("conformance: no response after %s: %w", c.timeout(), err)
+		} else if !isReset(err) {
+			return buf.Bytes(), fmt.Errorf("conformance: response failed: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Checks is the full list of checks, in the order Checker.Run() runs them.
+var Checks = []Check{
+	{"empty-selector", "The empty selector returns a valid menu", checkEmptySelector},
+	{"menu-crlf", "Menu lines end with CRLF and the menu ends with '.'", checkMenuCRLF},
+	{"request-lf", "A request terminated with a bare LF is accepted", checkRequestLF},
+	{"text-terminator", "Text items end with a '.' line, and nothing follows it", checkTextTerminator},
+	{"text-dot-stuffing", "Lines of text items that start with '.' are escaped", checkTextDotStuffing},
+	{"selector-limit", "Selectors up to the size limit are served and larger ones refused", checkSelectorLimit},
+	{"tls", "A request starting with 0x16 negotiates TLS, or is refused", checkTLS},
+	{"iibis", "A GopherIIbis request with a format string is served", checkIIbis},
+	{"meta", "A metadata request returns a valid listing, or is refused", checkMeta},
+	{"plus", "A Gopher+ request returns a valid Gopher+ response, or a plain one", checkPlus},
+	{"caps", "caps.txt, if present, is valid", checkCaps},
+	{"error-format", "Errors for missing selectors can be detected by clients", checkErrorFormat},
+	{"timeout", "Clients that never finish their selector are disconnected", checkTimeout},
+}
+
+// Check is a single conformance check.
+type Check struct {
+	Name        string
+	Description string
+	Func        func(ctx context.Context, c *Checker) Result
+}
+
+type Outcome int
+
+const (
+	Pass Outcome = iota + 1
+	Fail
+	Skip // The check does not apply to the server, or could not be performed
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Pass:
+		return "PASS"
+	case Fail:
+		return "FAIL"
+	case Skip:
+		return "SKIP"
+	default:
+		return fmt.Sprintf("Outcome(%d)", int(o))
+	}
+}
+
+// Result of a Check, with an explanation of the Outcome in Detail.
+type Result struct {
+	Check   string
+	Outcome Outcome
+	Detail  string
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s %s: %s", r.Outcome, r.Check, r.Detail)
+}
+
+// Failed reports whether any of results failed.
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Outcome == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+func pass(format string, args ...interface{}) Result {
+	return Result{Outcome: Pass, Detail: fmt.Sprintf(format, args...)}
+}
+
+func fail(format string, args ...interface{}) Result {
+	return Result{Outcome: Fail, Detail: fmt.Sprintf(format, args...)}
+}
+
+func skip(format string, args ...interface{}) Result {
+	return Result{Outcome: Skip, Detail: fmt.Sprintf(format, args...)}
+}
+
+func isTimeout(err error) bool {
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+func isReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,200 @@
+package conformance
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
+	"github.com/shabbyrobe/furlib/gopher/gophertest"
+)
+
+type nilLogger struct{}
+
+func (nilLogger) Printf(format string, v ...interface{}) {}
+
+func testHandler() gopher.Handler {
+	return gopher.HandlerFunc(func(ctx context.Context, w gopher.ResponseWriter, r *gopher.Request) {
+		switch r.URL().Selector {
+		case "":
+			dw := gopher.NewDirWriter(w, r)
+			dw.Info("hello")
+			dw.Text("Text", "/text")
+			dw.MustFlush()
+		case "/text":
+			w.Write([]byte("hello\r\n..dotted\r\n.\r\n"))
+		case "caps.txt":
+			w.Write([]byte("CAPS\r\n\r\nCapsVersion=1\r\nServerSoftware=furlib\r\n"))
+		default:
+			gopher.RespondError(w, r, gopher.StatusNotFound, "Not found")
+		}
+	})
+}
+
+func TestCheckerServer(t *testing.T) {
+	srv := gophertest.NewUnstartedServer(testHandler())
+	srv.Config.ReadSelectorTimeout = 200 * time.Millisecond
+	srv.Config.ErrorLog = nilLogger{}
+	srv.StartTLS()
+	defer srv.Close()
+
+	checker := &Checker{Addr: srv.Addr, Timeout: 5 * time.Second, IdleTimeout: 5 * time.Second}
+	results := checker.Run(context.Background())
+	if len(results) != len(Checks) {
+		t.Fatal(len(results))
+	}
+
+	expected := map[string]Outcome{
+		"meta": Skip, // No MetaHandler
+	}
+	for _, result := range results {
+		outcome, ok := expected[result.Check]
+		if !ok {
+			outcome = Pass
+		}
+		if result.Outcome != outcome {
+			t.Error(result)
+		}
+	}
+}
+
+func TestCheckerPlainServer(t *testing.T) {
+	srv := gophertest.NewUnstartedServer(testHandler())
+	srv.Config.ErrorLog = nilLogger{}
+	srv.Start()
+	defer srv.Close()
+
+	checker := &Checker{Addr: srv.Addr, Timeout: 5 * time.Second}
+	results := checker.Run(context.Background(), checkByName(t, "tls"))
+	if results[0].Outcome != Skip {
+		t.Fatal(results[0])
+	}
+}
+
+func TestCheckerFailures(t *testing.T) {
+	const menu = "iHello\t\tnull.host\t1\r\n0Text\t/text\tlocalhost\t70\r\n.\r\n"
+
+	for idx, tc := range []struct {
+		check   string
+		rsp     string // Response to everything except the root menu
+		menu    string
+		outcome Outcome
+	}{
+		{check: "menu-crlf", menu: "iHello\t\tnull.host\t1\n.\r\n", outcome: Fail},
+		{check: "menu-crlf", menu: "iHello\t\tnull.host\t1\r\n", outcome: Fail},
+		{check: "empty-selector", menu: "3Nope\t\tnull.host\t1\r\n.\r\n", outcome: Fail},
+		{check: "text-terminator", rsp: "hello\r\n", outcome: Fail},
+		{check: "text-terminator", rsp: "hello\r\n.\r\nmore\r\n.\r\n", outcome: Fail},
+		{check: "text-terminator", rsp: "hello\r\n.\r\n", outcome: Pass},
+		{check: "text-dot-stuffing", rsp: "hello\r\n.dotted\r\n.\r\n", outcome: Fail},
+		{check: "text-dot-stuffing", rsp: "hello\r\n.\r\n", outcome: Skip},
+		{check: "text-dot-stuffing", rsp: "..dotted\r\n.\r\n", outcome: Pass},
+		{check: "plus", menu: "+5\r\n.\r\n", outcome: Fail},
+		{check: "plus", menu: "+-1\r\niHello\t\tnull.host\t1\r\n", outcome: Fail},
+		{check: "caps", rsp: "CAPS\r\nnope\r\n", outcome: Fail},
+		{check: "caps", rsp: "CAPS\r\nCapsVersion=1\r\nServerTLSPort=0\r\n", outcome: Fail},
+		{check: "caps", rsp: "CAPS\r\nCapsVersion=1\r\nNotAKey=1\r\n", outcome: Fail},
+		{check: "caps", rsp: "CAPS\r\nCapsVersion=1\r\nServerTLSPort=7443\r\n", outcome: Pass},
+		{check: "caps", rsp: "3Nope\t\tnull.host\t1\r\n.\r\n", outcome: Skip},
+		{check: "error-format", rsp: "hello\r\n.\r\n", outcome: Fail},
+		{check: "error-format", rsp: "", outcome: Fail},
+		{check: "selector-limit", rsp: "iServed\t\tnull.host\t1\r\n.\r\n", outcome: Fail},
+		{check: "selector-limit", rsp: "3Not found\t\terror.host\t1\r\n.\r\n", outcome: Fail},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			addr := testRawServer(t, func(line string) string {
+				if line == "" || line == "\t+" {
+					if tc.menu != "" {
+						return tc.menu
+					}
+					return menu
+				}
+				return tc.rsp
+			})
+			checker := &Checker{Addr: addr, TextSelector: "/text", Timeout: 2 * time.Second, RequestSizeLimit: 64}
+			result := checker.Run(context.Background(), checkByName(t, tc.check))[0]
+			if result.Outcome != tc.outcome {
+				t.Fatal(result)
+			}
+		})
+	}
+}
+
+func TestCheckerSelectorLimitUnenforced(t *testing.T) {
+	srv := gophertest.NewUnstartedServer(testHandler())
+	srv.Config.RequestSizeLimit = 1 << 16
+	srv.Config.ErrorLog = nilLogger{}
+	srv.Start()
+	defer srv.Close()
+
+	checker := &Checker{Addr: srv.Addr, Timeout: 5 * time.Second, RequestSizeLimit: 64}
+	result := checker.Run(context.Background(), checkByName(t, "selector-limit"))[0]
+	if result.Outcome != Fail {
+		t.Fatal(result)
+	}
+
+	checker.RequestSizeLimit = 1 << 16
+	result = checker.Run(context.Background(), checkByName(t, "selector-limit"))[0]
+	if result.Outcome != Pass {
+		t.Fatal(result)
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	addr := testRawServer(t, func(line string) string { return "" })
+	checker := &Checker{Addr: addr, IdleTimeout: 100 * time.Millisecond}
+	result := checker.Run(context.Background(), checkByName(t, "timeout"))[0]
+	if result.Outcome != Fail {
+		t.Fatal(result)
+	}
+}
+
+func checkByName(t *testing.T, name string) Check {
+	t.Helper()
+	for _, check := range Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	t.Fatal("unknown check", name)
+	return Check{}
+}
+
+// testRawServer serves rsp(line) to each connection, where line is the request line
+// without the line ending. It never gives up on a client that doesn't send a line.
+func testRawServer(t *testing.T, rsp func(line string) string) (addr string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				if len(line) > 0 && line[len(line)-1] == '\n' {
+					line = line[:len(line)-1]
+				}
+				if len(line) > 0 && line[len(line)-1] == '\r' {
+					line = line[:len(line)-1]
+				}
+				conn.Write([]byte(rsp(line)))
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
@@ -0,0 +1,484 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shabbyrobe/furlib/capsfile"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Selector requested by the error-format check. Hopefully nobody has one of these.
+const missingSelector = "/furlib-conformance/does-not-exist"
+
+var errNoTextItem = errors.New("no text item found on the root menu; set TextSelector to check text")
+
+func checkEmptySelector(ctx context.Context, c *Checker) Result {
+	data, err := c.exchange(ctx, "\r\n")
+	if err != nil {
+		return fail("%v", err)
+	}
+	dirents, err := parseMenu(data)
+	if err != nil {
+		return fail("the empty selector did not return a valid menu: %v", err)
+	}
+	return pass("the root menu has %d items", len(dirents))
+}
+
+func checkMenuCRLF(ctx context.Context, c *Checker) Result {
+	data, err := c.exchange(ctx, "\r\n")
+	if err != nil {
+		return fail("%v", err)
+	}
+	lines := splitLines(data)
+	if len(lines) == 0 {
+		return fail("the root menu is empty")
+	}
+	for i, line := range lines {
+		if !bytes.HasSuffix(line, crlf) {
+			if i == len(lines)-1 && !bytes.HasSuffix(line, lf) {
+				return fail("the last line of the root menu has no line ending: %s", quote(line))
+			}
+			return fail("line %d of the root menu ends with a bare LF; RFC 1436 requires CRLF: %s", i+1, quote(line))
+		}
+	}
+	if last := lines[len(lines)-1]; !bytes.Equal(last, dotCRLF) {
+		return fail("the root menu does not end with a '.' line, so clients can't tell it from a truncated one; last line was %s", quote(last))
+	}
+	return pass("all %d lines of the root menu end with CRLF, and the last is '.'", len(lines))
+}
+
+func checkRequestLF(ctx context.Context, c *Checker) Result {
+	data, err := c.exchange(ctx, "\n")
+	if err != nil {
+		return fail("%v", err)
+	}
+	if _, err := parseMenu(data); err != nil {
+		return fail("an empty selector terminated with LF did not return a valid menu; "+
+			"RFC 1436 requires CRLF, but many clients only send LF: %v", err)
+	}
+	return pass("the root menu was served")
+}
+
+func checkTextTerminator(ctx context.Context, c *Checker) Result {
+	sel, data, err := c.fetchText(ctx)
+	if err != nil {
+		return textErrorResult(err)
+	}
+
+	lines := splitLines(data)
+	for i, line := range lines {
+		if !bytes.Equal(bytes.TrimRight(line, "\r\n"), dot) {
+			continue
+		}
+		if i < len(lines)-1 {
+			var after int
+			for _, l := range lines[i+1:] {
+				after += len(l)
+			}
+			return fail("%d bytes follow the '.' line at line %d of %q; "+
+				"a line consisting of '.' may not have been escaped as '..'", after, i+1, sel)
+		}
+		if !bytes.Equal(line, dotCRLF) {
+			return fail("the '.' line at the end of %q ends with a bare LF; RFC 1436 requires CRLF", sel)
+		}
+		return pass("%q ends with a '.' line after %d lines of text", sel, len(lines)-1)
+	}
+	return fail("%q does not end with a '.' line, so clients can't tell it from a truncated response", sel)
+}
+
+func checkTextDotStuffing(ctx context.Context, c *Checker) Result {
+	sel, data, err := c.fetchText(ctx)
+	if err != nil {
+		return textErrorResult(err)
+	}
+
+	lines := splitLines(data)
+	var stuffed int
+	for i, line := range lines {
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 || line[0] != '.' {
+			continue
+		}
+		if bytes.Equal(line, dot) {
+			if i < len(lines)-1 {
+				return fail("line %d of %q is a lone '.' but more text follows it; "+
+					"lines starting with '.' must be sent as '..'", i+1, sel)
+			}
+			continue
+		}
+		if len(line) < 2 || line[1] != '.' {
+			return fail("line %d of %q starts with a single '.'; "+
+				"lines starting with '.' must be sent as '..': %s", i+1, sel, quote(line))
+		}
+		stuffed++
+	}
+	if stuffed == 0 {
+		return skip("no lines of %q start with '.', so escaping could not be checked; "+
+			"set TextSelector to an item that has some", sel)
+	}
+	return pass("all lines of %q starting with '.' were escaped (%d found)", sel, stuffed)
+}
+
+func checkSelectorLimit(ctx context.Context, c *Checker) Result {
+	// The limit includes the CRLF, as it does for gopher.Server.RequestSizeLimit:
+	limit := c.requestSizeLimit()
+	if limit < 4 {
+		return skip("RequestSizeLimit %d is too small to check", limit)
+	}
+
+	data, err := c.exchange(ctx, "/"+strings.Repeat("a", limit-3)+"\r\n")
+	if err != nil {
+		return fail("a %d byte request, which is within the limit, failed: %v", limit, err)
+	} else if len(data) == 0 {
+		return fail("the server sent nothing in response to a %d byte request, which is within the limit", limit)
+	}
+	within := detectError(data)
+
+	over := limit * 2
+	data, err = c.exchange(ctx, "/"+strings.Repeat("a", over-3)+"\r\n")
+	if err != nil {
+		if isTimeout(err) {
+			return fail("the server was still waiting %s after a %d byte request; "+
+				"it should refuse requests over %d bytes", c.timeout(), over, limit)
+		}
+		return fail("a %d byte request failed: %v", over, err)
+	}
+	if len(data) == 0 {
+		return pass("a %d byte request was refused by closing the connection", over)
+	}
+	if gerr := detectError(data); gerr != nil {
+		// A server with no limit, or a bigger one, will send the same error it sent for
+		// the request within the limit, which is most likely 'not found':
+		if gerr.Status == gopher.StatusNotFound || (within != nil && within.Status == gerr.Status) {
+			return fail("a %d byte request got status %d, as if it were within the limit; requests over %d bytes "+
+				"should be refused. Set RequestSizeLimit if the server has a different limit", over, gerr.Status, limit)
+		}
+		return pass("a %d byte request was refused with status %d: %s", over, gerr.Status, quote([]byte(gerr.Message)))
+	}
+	return fail("a %d byte request was served; requests over %d bytes should be refused. "+
+		"Set RequestSizeLimit if the server has a different limit", over, limit)
+}
+
+func checkTLS(ctx context.Context, c *Checker) Result {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return fail("%v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(c.deadline(ctx, c.timeout()))
+
+	// The TLS ClientHello starts with 0x16, which is how the server knows to
+	// negotiate TLS rather than read a selector:
+	tc := tls.Client(conn, c.tlsConfig())
+	if err := tc.Handshake(); err != nil {
+		var rhe tls.RecordHeaderError
+		if errors.As(err, &rhe) {
+			return skip("the server does not support TLS; it responded in plain text, as it should: %s", quote(rhe.RecordHeader[:]))
+		} else if isTimeout(err) {
+			return fail("the server neither negotiated TLS nor responded after %s; "+
+				"clients that try TLS first will hang until they time out", c.timeout())
+		} else if isReset(err) || errors.Is(err, io.EOF) {
+			return skip("the server does not support TLS; it closed the connection")
+		}
+		return fail("TLS negotiation failed: %v", err)
+	}
+
+	data, err := c.exchangeConn(ctx, tc, "\r\n")
+	if err != nil {
+		return fail("TLS was negotiated but the request failed: %v", err)
+	}
+	dirents, err := parseMenu(data)
+	if err != nil {
+		return fail("TLS was negotiated but the empty selector did not return a valid menu: %v", err)
+	}
+	return pass("negotiated %s, and the root menu has %d items", tlsVersionName(tc.ConnectionState().Version), len(dirents))
+}
+
+func checkIIbis(ctx context.Context, c *Checker) Result {
+	// An empty selector, an empty search, an empty format string and the '0' data
+	// flag. Servers that don't support GopherIIbis should ignore the extra fields:
+	data, err := c.exchange(ctx, "\t\t0\r\n")
+	if err != nil {
+		return fail("%v", err)
+	}
+	dirents, err := parseMenu(data)
+	if err != nil {
+		return fail("a GopherIIbis request for the root menu did not return a valid menu: %v", err)
+	}
+	return pass("the root menu has %d items", len(dirents))
+}
+
+func checkMeta(ctx context.Context, c *Checker) Result {
+	data, err := c.exchange(ctx, "\t"+string(gopher.MetaItem)+"\r\n")
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	if bytes.HasPrefix(data, plusError) {
+		return skip("the server refused the metadata request, as servers without metadata should: %s", quote(data))
+
+	} else if bytes.HasPrefix(data, metaBegin) {
+		lines := splitLines(data)
+		if len(lines) < 2 || !bytes.HasPrefix(lines[1], metaInfo) {
+			return fail("the metadata listing does not start with an INFO record: %s", quote(data))
+		}
+		if !bytes.Equal(lines[len(lines)-1], dotCRLF) {
+			return fail("the metadata listing does not end with a '.' line")
+		}
+		var records int
+		for _, line := range lines[1:] {
+			if len(line) > 0 && line[0] == '+' {
+				records++
+			}
+		}
+		return pass("the metadata listing for the root menu has %d records", records)
+	}
+
+	if gerr := detectError(data); gerr != nil {
+		return skip("the server refused the metadata request, as servers without metadata should: %s", quote(data))
+	}
+	if _, err := parseMenu(data); err == nil {
+		return skip("the server does not support metadata; it ignored the '!' and served the root menu")
+	}
+	return fail("the response to a metadata request was not a metadata listing, an error or a menu: %s", quote(data))
+}
+
+func checkPlus(ctx context.Context, c *Checker) Result {
+	data, err := c.exchange(ctx, "\t+\r\n")
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	if bytes.HasPrefix(data, plusError) {
+		return fail("the server refused a Gopher+ request for the root menu: %s", quote(data))
+
+	} else if len(data) > 0 && data[0] == '+' {
+		nl := bytes.IndexByte(data, '\n')
+		if nl < 0 {
+			return fail("the Gopher+ header has no line ending: %s", quote(data))
+		}
+		header, body := string(bytes.TrimRight(data[1:nl], "\r")), data[nl+1:]
+		size, err := strconv.Atoi(header)
+		if err != nil {
+			return fail("the Gopher+ header does not contain a valid length: %s", quote(data[:nl+1]))
+		}
+		switch {
+		case size == -1:
+			if !bytes.HasSuffix(body, dotCRLF) {
+				return fail("the Gopher+ header promised a response ending with a '.' line, but it does not")
+			}
+			return pass("the server sent a Gopher+ response ending with a '.' line")
+		case size == -2:
+			return pass("the server sent a Gopher+ response of %d bytes, ended by closing the connection", len(body))
+		case size >= 0:
+			if len(body) != size {
+				return fail("the Gopher+ header promised %d bytes, but %d were sent", size, len(body))
+			}
+			return pass("the server sent a Gopher+ response of %d bytes, as promised by its header", size)
+		default:
+			return fail("the Gopher+ header contains an invalid length: %s", quote(data[:nl+1]))
+		}
+	}
+
+	if _, err := parseMenu(data); err != nil {
+		return fail("the response to a Gopher+ request was neither a Gopher+ response nor a valid menu: %v", err)
+	}
+	return skip("the server does not support Gopher+; it served the root menu as plain Gopher, which Gopher+ clients accept")
+}
+
+func checkCaps(ctx context.Context, c *Checker) Result {
+	data, err := c.exchange(ctx, "caps.txt\r\n")
+	if err != nil {
+		return fail("%v", err)
+	}
+	if !bytes.HasPrefix(data, capsMagic) {
+		return skip("the server does not have a caps.txt: %s", quote(data))
+	}
+
+	caps, err := capsfile.ParseCapsBytes(c.Addr, data, 0)
+	if err != nil {
+		return fail("caps.txt is invalid: %v", err)
+	}
+	if errs := caps.Validate(); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, verr := range errs {
+			msgs[i] = fmt.Sprintf("line %d: key %q: %v", verr.Line, verr.Key, verr.Err)
+		}
+		return fail("caps.txt has %d invalid keys; %s", len(errs), strings.Join(msgs, "; "))
+	}
+	if name, version := caps.Software(); name != "" {
+		return pass("caps.txt version %d is valid; server software is %s", caps.Version(), strings.TrimSpace(name+" "+version))
+	}
+	return pass("caps.txt version %d is valid", caps.Version())
+}
+
+func checkErrorFormat(ctx context.Context, c *Checker) Result {
+	data, err := c.exchange(ctx, missingSelector+"\r\n")
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	gerr := detectError(data)
+	if gerr == nil {
+		return fail("the response for a missing selector was not recognised as an error; "+
+			"send a menu containing a type 3 item: %s", quote(data))
+	} else if gerr.Status == gopher.StatusEmpty {
+		return fail("the server sent nothing for a missing selector, so clients can't tell what went wrong; " +
+			"send a menu containing a type 3 item")
+	}
+	return pass("the response for a missing selector was recognised as status %d (%s): %s",
+		gerr.Status, gopher.StatusText(gerr.Status), quote([]byte(gerr.Message)))
+}
+
+func checkTimeout(ctx context.Context, c *Checker) Result {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return fail("%v", err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	conn.SetDeadline(c.deadline(ctx, c.idleTimeout()))
+	if _, err := conn.Write([]byte("/")); err != nil {
+		return fail("request failed: %v", err)
+	}
+
+	// Whatever the server sends, we're only interested in when it hangs up:
+	if _, err := ioutil.ReadAll(conn); isTimeout(err) {
+		return fail("the connection was still open %s after sending an incomplete selector; "+
+			"slow or broken clients can tie up the server", c.idleTimeout())
+	}
+	return pass("the server hung up %s after an incomplete selector was sent", time.Since(start).Round(time.Millisecond))
+}
+
+// fetchText finds the text item to check, and returns its selector and the raw
+// response.
+func (c *Checker) fetchText(ctx context.Context) (sel string, data []byte, err error) {
+	sel = c.TextSelector
+	if sel == "" {
+		data, err := c.exchange(ctx, "\r\n")
+		if err != nil {
+			return "", nil, err
+		}
+		dirents, err := parseMenu(data)
+		if err != nil {
+			return "", nil, fmt.Errorf("conformance: could not find a text item to check: %w", err)
+		}
+
+		_, port, _ := net.SplitHostPort(c.Addr)
+		for _, dirent := range dirents {
+			if dirent.ItemType == gopher.Text && dirent.Port == port {
+				sel = dirent.Selector
+				break
+			}
+		}
+		if sel == "" {
+			return "", nil, errNoTextItem
+		}
+	}
+
+	data, err = c.exchange(ctx, sel+"\r\n")
+	return sel, data, err
+}
+
+func textErrorResult(err error) Result {
+	if errors.Is(err, errNoTextItem) {
+		return skip("%v", err)
+	}
+	return fail("%v", err)
+}
+
+// deadline returns the time timeout from now, or the deadline of ctx if that is
+// sooner.
+func (c *Checker) deadline(ctx context.Context, timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return deadline
+}
+
+var (
+	crlf      = []byte("\r\n")
+	lf        = []byte("\n")
+	dot       = []byte(".")
+	dotCRLF   = []byte(".\r\n")
+	plusError = []byte("--")
+	metaBegin = []byte("+-1")
+	metaInfo  = []byte("+INFO:")
+	capsMagic = []byte("CAPS")
+)
+
+// parseMenu parses data as a menu, failing if it is empty, or is recognised as an
+// error.
+func parseMenu(data []byte) ([]gopher.Dirent, error) {
+	if gerr := detectError(data); gerr != nil {
+		return nil, fmt.Errorf("server responded with status %d: %s", gerr.Status, quote([]byte(gerr.Message)))
+	}
+
+	var dirents []gopher.Dirent
+	rdr := gopher.NewDirReader(bytes.NewReader(data))
+	for {
+		var dirent gopher.Dirent
+		if !rdr.Read(&dirent) {
+			break
+		}
+		dirents = append(dirents, dirent)
+	}
+	if err := rdr.ReadErr(); err != nil {
+		return nil, err
+	}
+	if len(dirents) == 0 {
+		return nil, fmt.Errorf("menu is empty")
+	}
+	return dirents, nil
+}
+
+func detectError(data []byte) *gopher.Error {
+	return gopher.DetectError(data, func(status gopher.Status, msg string, confidence float64) *gopher.Error {
+		return gopher.NewError(gopher.URL{}, status, msg, confidence)
+	})
+}
+
+// splitLines splits data into lines, keeping the line endings so they can be checked.
+func splitLines(data []byte) [][]byte {
+	lines := bytes.SplitAfter(data, lf)
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// quote returns data quoted for an explanation, truncated if it is long.
+func quote(data []byte) string {
+	const max = 60
+	if len(data) > max {
+		return strconv.Quote(string(data[:max])) + "..."
+	}
+	return strconv.Quote(string(data))
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("TLS version 0x%04x", v)
+	}
+}
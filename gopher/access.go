@@ -0,0 +1,240 @@
+package gopher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// AccessRule controls who may request the selectors matched by Pattern.
+//
+// A request is denied if the remote address is in Deny. Otherwise, if Allow and
+// AllowCerts are both empty, the request is allowed; if not, the request is only
+// allowed if the remote address is in Allow, or the client presented a TLS certificate
+// listed in AllowCerts.
+//
+// If the remote address is unknown, i.e. the request came over a Unix socket or a
+// pipe, it is presumed to be in Deny and not in Allow, so rules fail closed.
+type AccessRule struct {
+	// Selector pattern, using the same syntax as Mux.Handle(). Use a catch-all to cover
+	// a whole section, i.e. '/internal/*rest' matches '/internal' and everything below
+	// it. Patterns are matched without regard to case, so params may only use the
+	// 'int', 'uint' and 'date' constraints, not regular expressions.
+	Pattern string
+
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+
+	// SHA-256 fingerprints of TLS client certificates, as hex. Colons are ignored, so
+	// the output of 'openssl x509 -fingerprint -sha256' can be used as-is. The Server's
+	// TLSConfig must request client certificates for this to be useful.
+	AllowCerts []string
+}
+
+type accessRule struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+	certs map[[sha256.Size]byte]struct{}
+}
+
+func (ar *accessRule) allowed(r *Request) bool {
+	var ip net.IP
+	if r.RemoteAddr != nil {
+		ip = r.RemoteAddr.IP
+	}
+	if ip == nil {
+		if len(ar.deny) > 0 {
+			return false
+		}
+	} else if ipNetsContain(ar.deny, ip) {
+		return false
+	}
+	if len(ar.allow) == 0 && len(ar.certs) == 0 {
+		return true
+	}
+	if ip != nil && ipNetsContain(ar.allow, ip) {
+		return true
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		_, ok := ar.certs[sha256.Sum256(r.TLS.PeerCertificates[0].Raw)]
+		return ok
+	}
+	return false
+}
+
+// ServeGopher is only implemented so an accessRule can be stored in a Mux; it is never
+// called.
+func (ar *accessRule) ServeGopher(ctx context.Context, w ResponseWriter, r *Request) {}
+
+// AccessControl wraps h so that requests are only passed to h if they are allowed by
+// the rule whose Pattern matches the selector. Requests that are denied receive a
+// StatusForbidden error. Requests that match no rule are allowed.
+//
+// Rules are matched in the same way as a Mux matches handlers, so the most specific
+// pattern wins. The selector is cleaned first, as a file server would clean it, so
+// '/pub/../internal' is subject to the rules for '/internal'. Matching ignores case,
+// so rules can't be sidestepped on case-insensitive filesystems:
+//
+//	office, _ := gopher.ParseCIDRs("192.0.2.0/24", "2001:db8::/32")
+//	h, err := gopher.AccessControl(mux,
+//		gopher.AccessRule{Pattern: "/internal/*rest", Allow: office},
+//		gopher.AccessRule{Pattern: "/internal/public/*rest"},
+//	)
+//
+// If h implements MetaHandler, so does the returned Handler, and meta requests are
+// subject to the same rules.
+func AccessControl(h Handler, rules ...AccessRule) (Handler, error) {
+	ac := &accessControlHandler{h: h, rules: NewMux()}
+	for _, rule := range rules {
+		ar := &accessRule{allow: rule.Allow, deny: rule.Deny}
+		for _, fp := range rule.AllowCerts {
+			sum, err := parseCertFingerprint(fp)
+			if err != nil {
+				return nil, err
+			}
+			if ar.certs == nil {
+				ar.certs = make(map[[sha256.Size]byte]struct{})
+			}
+			ar.certs[sum] = struct{}{}
+		}
+		pattern, err := accessPattern(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		if err := handleAccessRule(ac.rules, pattern, ar); err != nil {
+			return nil, err
+		}
+	}
+
+	if mh, ok := h.(MetaHandler); ok {
+		return &accessControlMetaHandler{accessControlHandler: ac, meta: mh}, nil
+	}
+	return ac, nil
+}
+
+type accessControlHandler struct {
+	h     Handler
+	rules *Mux
+}
+
+func (ac *accessControlHandler) allowed(r *Request) bool {
+	node, params := ac.rules.findNode(accessSelector(r.url.Selector))
+	ac.rules.putParams(params)
+	if node == nil || node.handler == nil {
+		return true
+	}
+	return node.handler.(*accessRule).allowed(r)
+}
+
+func (ac *accessControlHandler) ServeGopher(ctx context.Context, w ResponseWriter, r *Request) {
+	if !ac.allowed(r) {
+		if err := RespondError(w, r, StatusForbidden, "Forbidden"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	ac.h.ServeGopher(ctx, w, r)
+}
+
+type accessControlMetaHandler struct {
+	*accessControlHandler
+	meta MetaHandler
+}
+
+func (ac *accessControlMetaHandler) ServeGopherMeta(ctx context.Context, w MetaWriter, r *Request) {
+	if !ac.allowed(r) {
+		w.MetaError(StatusForbidden, "Forbidden")
+		return
+	}
+	ac.meta.ServeGopherMeta(ctx, w, r)
+}
+
+// accessSelector normalises sel for matching against the rules, so that selectors
+// which would reach the same resource can't bypass them.
+func accessSelector(sel string) string {
+	return strings.ToLower(path.Clean("/" + sel))
+}
+
+// accessPattern lowercases the static segments of pattern to match accessSelector.
+// Regular expression constraints are refused, as they may be case-sensitive, and a
+// rule that can never match would leave the selectors it was meant to cover open.
+func accessPattern(pattern string) (string, error) {
+	parts := splitMuxPattern(pattern)
+	for i, part := range parts {
+		if isConstrainedParam(part) {
+			switch expr := part[strings.IndexByte(part, '{')+1 : len(part)-1]; expr {
+			case "int", "uint", "date":
+			default:
+				return "", fmt.Errorf("gopher: access rule pattern %q: constraint {%s} is not supported; only int, uint and date are", pattern, expr)
+			}
+		} else if !strings.HasPrefix(part, ":") && !strings.HasPrefix(part, "*") {
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// handleAccessRule adds ar to rules, returning the error that Mux.Handle panics with
+// if the pattern is invalid or already has a rule.
+func handleAccessRule(rules *Mux, pattern string, ar *accessRule) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rerr, ok := r.(error); ok {
+				err = rerr
+			} else {
+				err = fmt.Errorf("gopher: access rule pattern %q: %v", pattern, r)
+			}
+		}
+	}()
+	rules.Handle(pattern, ar, nil)
+	return nil
+}
+
+// ParseCIDRs parses a list of CIDR blocks for use in an AccessRule or ProxyListener.
+// Bare IP addresses are treated as a block containing only that address.
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("gopher: invalid IP address %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("gopher: invalid CIDR %q: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func ipNetsContain(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCertFingerprint(fp string) (sum [sha256.Size]byte, err error) {
+	raw, err := hex.DecodeString(strings.ReplaceAll(fp, ":", ""))
+	if err != nil || len(raw) != sha256.Size {
+		return sum, fmt.Errorf("gopher: invalid SHA-256 certificate fingerprint %q", fp)
+	}
+	copy(sum[:], raw)
+	return sum, nil
+}
@@ -0,0 +1,144 @@
+package gopher
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestAccessControl(t *testing.T) {
+	office, err := ParseCIDRs("192.0.2.0/24", "2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked, _ := ParseCIDRs("192.0.2.66")
+
+	cert := &x509.Certificate{Raw: []byte("cert")}
+	sum := sha256.Sum256(cert.Raw)
+	var fp []string
+	for _, b := range sum {
+		fp = append(fp, fmt.Sprintf("%02X", b))
+	}
+
+	mux := NewMux()
+	mux.Handle("/*path", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Write([]byte("ok"))
+	}), nil)
+
+	h, err := AccessControl(mux,
+		AccessRule{Pattern: "/internal/*rest", Allow: office, Deny: blocked, AllowCerts: []string{strings.Join(fp, ":")}},
+		AccessRule{Pattern: "/internal/public/*rest"},
+		AccessRule{Pattern: "/private.txt", Deny: office},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, tc := range []struct {
+		sel  string
+		ip   string
+		cert bool
+		ok   bool
+	}{
+		{"/", "203.0.113.1", false, true},
+		{"/internal", "203.0.113.1", false, false},
+		{"/internal/foo", "203.0.113.1", false, false},
+		{"/internal/foo", "192.0.2.1", false, true},
+		{"/internal/foo", "192.0.2.66", false, false},
+		{"/internal/foo", "2001:db8::1", false, true},
+		{"/internal/foo", "2001:db8::2", false, false},
+		{"/internal/foo", "203.0.113.1", true, true},
+		{"/internal/foo", "", false, false},
+		{"/internal/public/foo", "203.0.113.1", false, true},
+		{"/private.txt", "192.0.2.1", false, false},
+		{"/private.txt", "", false, false},
+		{"/internal/foo", "", true, false}, // Unknown address is presumed to be in Deny
+		{"/", "", false, true},
+
+		// Selectors that reach the same resource once cleaned must not bypass the rules:
+		{"/./internal/foo", "203.0.113.1", false, false},
+		{"/pub/../internal/foo", "203.0.113.1", false, false},
+		{"//internal//foo", "203.0.113.1", false, false},
+		{"internal/foo", "203.0.113.1", false, false},
+		{"/../internal/foo", "203.0.113.1", false, false},
+		{"/INTERNAL/foo", "203.0.113.1", false, false},
+		{"/Internal/Public/foo", "203.0.113.1", false, true},
+		{"/./internal/foo", "192.0.2.1", false, true},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			rq := NewRequest(URL{Selector: tc.sel}, nil)
+			if tc.ip != "" {
+				rq.RemoteAddr = &net.TCPAddr{IP: net.ParseIP(tc.ip)}
+			}
+			if tc.cert {
+				rq.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+			}
+
+			var out strings.Builder
+			h.ServeGopher(context.Background(), &out, rq)
+			if ok := out.String() == "ok"; ok != tc.ok {
+				t.Fatalf("%q", out.String())
+			}
+			if !tc.ok && !strings.Contains(out.String(), "Forbidden") {
+				t.Fatalf("%q", out.String())
+			}
+		})
+	}
+
+	if _, ok := h.(MetaHandler); !ok {
+		t.Fatal()
+	}
+}
+
+func TestAccessControlInvalidFingerprint(t *testing.T) {
+	_, err := AccessControl(NewMux(), AccessRule{Pattern: "/*rest", AllowCerts: []string{"AB:CD"}})
+	if err == nil {
+		t.Fatal()
+	}
+}
+
+func TestAccessControlInvalidPattern(t *testing.T) {
+	for idx, pattern := range []string{
+		"/admin/:id{[A-Z]+}",
+		"/admin/:id{[a-z]+}",
+		"/admin/*rest/foo",
+		"/admin/:{int}",
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			if _, err := AccessControl(NewMux(), AccessRule{Pattern: pattern}); err == nil {
+				t.Fatal()
+			}
+		})
+	}
+
+	_, err := AccessControl(NewMux(), AccessRule{Pattern: "/admin"}, AccessRule{Pattern: "/ADMIN"})
+	if err == nil {
+		t.Fatal()
+	}
+
+	_, err = AccessControl(NewMux(), AccessRule{Pattern: "/post/:id{int}"}, AccessRule{Pattern: "/day/:day{date}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := ParseCIDRs("10.0.0.0/8", "192.0.2.1", "::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nets[1].String() != "192.0.2.1/32" || nets[2].String() != "::1/128" {
+		t.Fatal(nets)
+	}
+	if _, err := ParseCIDRs("nope"); err == nil {
+		t.Fatal()
+	}
+	if _, err := ParseCIDRs("10.0.0.0/99"); err == nil {
+		t.Fatal()
+	}
+}
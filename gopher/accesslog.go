@@ -0,0 +1,173 @@
+package gopher
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AccessLogEntry describes a single request received by a Server.
+type AccessLogEntry struct {
+	Time       time.Time // Time the request was accepted
+	RemoteAddr net.Addr  // May be nil
+	Selector   string
+	Search     string
+	Dialect    Dialect
+	TLS        bool
+	Bytes      int64 // Bytes written to the client, excluding TLS overhead
+	Duration   time.Duration
+
+	// Status of any error sent to the client, or OK. Errors are only reported if they
+	// were sent with RespondError, MetaWriter.MetaError, or by the Server itself.
+	Status Status
+}
+
+// AccessLogger receives an AccessLogEntry for every request served by a Server.
+// LogAccess is called from the connection's goroutine, so it may be called
+// concurrently and should not block for long.
+type AccessLogger interface {
+	LogAccess(entry *AccessLogEntry)
+}
+
+type AccessLoggerFunc func(entry *AccessLogEntry)
+
+func (fn AccessLoggerFunc) LogAccess(entry *AccessLogEntry) { fn(entry) }
+
+// AccessLogEncoder appends an encoded AccessLogEntry to buf, without a trailing
+// newline.
+type AccessLogEncoder func(buf []byte, entry *AccessLogEntry) []byte
+
+var (
+	_ AccessLogEncoder = CommonLogEncoder
+	_ AccessLogEncoder = JSONLogEncoder
+)
+
+// NewAccessLogger returns an AccessLogger that writes each entry to w on its own line,
+// using enc. Writes to w are serialised.
+func NewAccessLogger(w io.Writer, enc AccessLogEncoder) AccessLogger {
+	return &accessLogger{w: w, enc: enc}
+}
+
+type accessLogger struct {
+	w   io.Writer
+	enc AccessLogEncoder
+	buf []byte
+	mu  sync.Mutex
+}
+
+func (al *accessLogger) LogAccess(entry *AccessLogEntry) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.buf = al.enc(al.buf[:0], entry)
+	al.buf = append(al.buf, '\n')
+	al.w.Write(al.buf)
+}
+
+const commonLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// CommonLogEncoder encodes entries in a format resembling the Common Log Format used by
+// web servers, with the request line replaced by the quoted selector and search, and a
+// few extra fields on the end:
+//
+//	<host> - - [<time>] "<selector>" "<search>" <status> <bytes> <dialect> <tls|-> <seconds>
+//
+// For example:
+//
+//	127.0.0.1 - - [10/Oct/2020:13:55:36 +1100] "/docs" "" 0 2326 gopher - 0.000124
+//
+func CommonLogEncoder(buf []byte, entry *AccessLogEntry) []byte {
+	buf = append(buf, accessLogHost(entry.RemoteAddr)...)
+	buf = append(buf, " - - ["...)
+	buf = entry.Time.AppendFormat(buf, commonLogTimeFormat)
+	buf = append(buf, "] "...)
+	buf = strconv.AppendQuote(buf, entry.Selector)
+	buf = append(buf, ' ')
+	buf = strconv.AppendQuote(buf, entry.Search)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(entry.Status), 10)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, entry.Bytes, 10)
+	buf = append(buf, ' ')
+	buf = append(buf, entry.Dialect.String()...)
+	if entry.TLS {
+		buf = append(buf, " tls "...)
+	} else {
+		buf = append(buf, " - "...)
+	}
+	buf = strconv.AppendFloat(buf, entry.Duration.Seconds(), 'f', 6, 64)
+	return buf
+}
+
+type jsonLogEntry struct {
+	Time       string  `json:"time"`
+	RemoteAddr string  `json:"remote_addr,omitempty"`
+	Selector   string  `json:"selector"`
+	Search     string  `json:"search,omitempty"`
+	Dialect    string  `json:"dialect"`
+	TLS        bool    `json:"tls"`
+	Bytes      int64   `json:"bytes"`
+	Duration   float64 `json:"duration"` // Seconds
+	Status     Status  `json:"status"`
+}
+
+// JSONLogEncoder encodes entries as a single-line JSON object, i.e.
+//
+//	{"time":"2020-10-10T13:55:36.123+11:00","remote_addr":"127.0.0.1:5000",
+//	 "selector":"/docs","dialect":"gopher","tls":false,"bytes":2326,
+//	 "duration":0.000124,"status":0}
+//
+func JSONLogEncoder(buf []byte, entry *AccessLogEntry) []byte {
+	var je = jsonLogEntry{
+		Time:     entry.Time.Format(time.RFC3339Nano),
+		Selector: entry.Selector,
+		Search:   entry.Search,
+		Dialect:  entry.Dialect.String(),
+		TLS:      entry.TLS,
+		Bytes:    entry.Bytes,
+		Duration: entry.Duration.Seconds(),
+		Status:   entry.Status,
+	}
+	if entry.RemoteAddr != nil {
+		je.RemoteAddr = entry.RemoteAddr.String()
+	}
+	out, err := json.Marshal(&je)
+	if err != nil {
+		// Should not be possible, everything in jsonLogEntry is marshalable:
+		panic(err)
+	}
+	return append(buf, out...)
+}
+
+func accessLogHost(addr net.Addr) string {
+	if addr == nil {
+		return "-"
+	}
+	s := addr.String()
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func newAccessLogEntry(start time.Time, r *Request, tw *trackingWriter) *AccessLogEntry {
+	entry := &AccessLogEntry{
+		Time:     start,
+		Selector: r.url.Selector,
+		Search:   r.url.Search,
+		Dialect:  r.dialect,
+		TLS:      r.TLS != nil,
+		Bytes:    tw.n,
+		Duration: time.Since(start),
+		Status:   tw.status,
+	}
+	if r.RemoteAddr != nil {
+		entry.RemoteAddr = r.RemoteAddr
+	}
+	return entry
+}
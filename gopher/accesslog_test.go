@@ -0,0 +1,107 @@
+package gopher
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCommonLogEncoder(t *testing.T) {
+	entry := &AccessLogEntry{
+		Time:       time.Date(2020, 10, 10, 13, 55, 36, 0, time.FixedZone("", 11*3600)),
+		RemoteAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+		Selector:   "/docs\tx",
+		Search:     "foo",
+		Dialect:    DialectPlus,
+		TLS:        true,
+		Bytes:      2326,
+		Duration:   124 * time.Microsecond,
+		Status:     StatusNotFound,
+	}
+	out := string(CommonLogEncoder(nil, entry))
+	expected := `127.0.0.1 - - [10/Oct/2020:13:55:36 +1100] "/docs\tx" "foo" 404 2326 gopher+ tls 0.000124`
+	if out != expected {
+		t.Fatal(out)
+	}
+
+	entry.RemoteAddr, entry.TLS = nil, false
+	out = string(CommonLogEncoder(nil, entry))
+	expected = `- - - [10/Oct/2020:13:55:36 +1100] "/docs\tx" "foo" 404 2326 gopher+ - 0.000124`
+	if out != expected {
+		t.Fatal(out)
+	}
+}
+
+func TestJSONLogEncoder(t *testing.T) {
+	entry := &AccessLogEntry{
+		Time:       time.Date(2020, 10, 10, 13, 55, 36, 0, time.UTC),
+		RemoteAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+		Selector:   "/docs",
+		Dialect:    DialectIIbis,
+		Bytes:      10,
+		Duration:   time.Second,
+	}
+	out := string(JSONLogEncoder(nil, entry))
+	expected := `{"time":"2020-10-10T13:55:36Z","remote_addr":"127.0.0.1:5000","selector":"/docs",` +
+		`"dialect":"gopher-iibis","tls":false,"bytes":10,"duration":1,"status":0}`
+	if out != expected {
+		t.Fatal(out)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerAccessLog(t *testing.T) {
+	var entries = make(chan *AccessLogEntry, 10)
+
+	mux := NewMux()
+	mux.Handle("/ok.txt", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Write([]byte("hello"))
+	}), nil)
+
+	addr := testServe(t, &Server{
+		Handler: mux,
+		AccessLog: AccessLoggerFunc(func(entry *AccessLogEntry) {
+			entries <- entry
+		}),
+	})
+
+	for idx, tc := range []struct {
+		rq       string
+		selector string
+		search   string
+		status   Status
+		dialect  Dialect
+		bytes    int64
+	}{
+		{"/ok.txt\r\n", "/ok.txt", "", OK, DialectGopher, 5},
+		{"/ok.txt\t+\r\n", "/ok.txt", "", OK, DialectPlus, 10},
+		{"/nope.txt\tsrch\r\n", "/nope.txt", "srch", StatusNotFound, DialectGopher, 0},
+		{"/nope.txt\t\t1\r\n", "/nope.txt", "", StatusNotFound, DialectIIbis, 0},
+		{"/bad\t\tx\r\n", "", "", StatusBadRequest, DialectGopher, 0},
+	} {
+		out := testRawRequest(t, addr, tc.rq)
+
+		var entry *AccessLogEntry
+		select {
+		case entry = <-entries:
+		case <-time.After(2 * time.Second):
+			t.Fatal(idx, "timeout")
+		}
+
+		if entry.Selector != tc.selector || entry.Search != tc.search ||
+			entry.Status != tc.status || entry.Dialect != tc.dialect {
+			t.Fatal(idx, entry)
+		}
+		if tc.bytes == 0 {
+			tc.bytes = int64(len(out))
+		}
+		if entry.Bytes != tc.bytes || entry.RemoteAddr == nil || entry.TLS {
+			t.Fatal(idx, entry)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package gopher
+
+import "fmt"
+
+// ConnState is the state of a connection to a Server, reported to the Server's
+// ConnState hook.
+type ConnState int
+
+const (
+	// StateNew is a connection that has just been accepted. Every connection starts in
+	// StateNew and finishes in StateClosed or StateHijacked.
+	StateNew ConnState = iota
+
+	// StateTLS is a connection that has started a TLS handshake. This happens before
+	// the request is read.
+	StateTLS
+
+	// StateActive is a connection that has had its request read, and is about to be
+	// handed to the Handler.
+	StateActive
+
+	// StateClosed is a connection that has been closed.
+	StateClosed
+
+	// StateHijacked is a connection that was taken over by a Handler with
+	// ServerResponseWriter.Hijack(). It is reported instead of StateClosed, and the
+	// Server is no longer responsible for the connection.
+	StateHijacked
+)
+
+var connStateNames = map[ConnState]string{
+	StateNew:      "new",
+	StateTLS:      "tls",
+	StateActive:   "active",
+	StateClosed:   "closed",
+	StateHijacked: "hijacked",
+}
+
+func (c ConnState) String() string {
+	if s, ok := connStateNames[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("ConnState(%d)", c)
+}
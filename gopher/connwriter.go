@@ -0,0 +1,86 @@
+package gopher
+
+import (
+	"net"
+	"time"
+)
+
+// Size of the chunks connWriter splits writes into, so that slow readers must keep
+// making progress to renew the WriteIdleTimeout.
+const writeChunkSize = 16 << 10
+
+// connWriter applies the Server's write timeouts and bandwidth throttling to a
+// connection.
+type connWriter struct {
+	conn     net.Conn
+	deadline time.Time // Zero if there is no WriteTimeout
+	idle     time.Duration
+	rate     int // Bytes per second, 0 if unlimited
+	chunk    int
+
+	// Used by the throttle:
+	start time.Time
+	sent  int64
+}
+
+func newConnWriter(conn net.Conn, srv *Server) *connWriter {
+	now := time.Now()
+	cw := &connWriter{
+		conn:  conn,
+		idle:  srv.WriteIdleTimeout,
+		rate:  srv.WriteRateLimit,
+		chunk: writeChunkSize,
+		start: now,
+	}
+	if srv.WriteTimeout > 0 {
+		cw.deadline = now.Add(srv.WriteTimeout)
+		conn.SetWriteDeadline(cw.deadline)
+	}
+	if cw.rate > 0 {
+		// Smaller chunks when throttling so we send a steady trickle rather than
+		// bursts followed by long pauses:
+		if chunk := cw.rate / 4; chunk < cw.chunk {
+			cw.chunk = chunk
+		}
+		if cw.chunk < 1 {
+			cw.chunk = 1
+		}
+	}
+	return cw
+}
+
+func (cw *connWriter) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > cw.chunk {
+			chunk = chunk[:cw.chunk]
+		}
+		if cw.rate > 0 {
+			cw.throttle()
+		}
+		if cw.idle > 0 {
+			deadline := time.Now().Add(cw.idle)
+			if !cw.deadline.IsZero() && cw.deadline.Before(deadline) {
+				deadline = cw.deadline
+			}
+			cw.conn.SetWriteDeadline(deadline)
+		}
+
+		wn, err := cw.conn.Write(chunk)
+		n += wn
+		cw.sent += int64(wn)
+		if err != nil {
+			return n, err
+		}
+		b = b[wn:]
+	}
+	return n, nil
+}
+
+// throttle sleeps until sending the next chunk would not exceed the rate limit.
+func (cw *connWriter) throttle() {
+	due := cw.start.Add(time.Duration(float64(cw.sent) / float64(cw.rate) * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		time.Sleep(wait)
+	}
+}
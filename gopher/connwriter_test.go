@@ -0,0 +1,79 @@
+package gopher
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func testStalledReader(t *testing.T, srv *Server) error {
+	t.Helper()
+
+	var result = make(chan error, 1)
+	var data = bytes.Repeat([]byte{'x'}, 1<<20)
+
+	srv.Handler = HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		// Enough to fill any socket buffers on loopback:
+		for i := 0; i < 64; i++ {
+			if _, err := w.Write(data); err != nil {
+				result <- err
+				return
+			}
+		}
+		result <- nil
+	})
+	addr := testServe(t, srv)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("/big\r\n"))
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+		return nil
+	}
+}
+
+func TestServerWriteIdleTimeout(t *testing.T) {
+	err := testStalledReader(t, &Server{WriteIdleTimeout: 50 * time.Millisecond})
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatal(err)
+	}
+}
+
+func TestServerWriteTimeout(t *testing.T) {
+	err := testStalledReader(t, &Server{WriteTimeout: 50 * time.Millisecond})
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatal(err)
+	}
+}
+
+func TestServerWriteRateLimit(t *testing.T) {
+	var data = bytes.Repeat([]byte{'x'}, 5000)
+	srv := &Server{
+		WriteRateLimit: 10000,
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.Write(data)
+		}),
+	}
+	addr := testServe(t, srv)
+
+	start := time.Now()
+	out := testRawRequest(t, addr, "/\r\n")
+	if out != string(data) {
+		t.Fatal(len(out))
+	}
+
+	// The first 2500 byte chunk is sent immediately, the second after 250ms:
+	if taken := time.Since(start); taken < 200*time.Millisecond {
+		t.Fatal(taken)
+	}
+}
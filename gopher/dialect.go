@@ -0,0 +1,35 @@
+package gopher
+
+// Dialect describes the flavour of the Gopher protocol a client used to make a request.
+// Servers use this to decide how to respond, particularly in the case of errors.
+type Dialect int
+
+const (
+	// Plain RFC 1436 Gopher, which includes GopherII requests as they are
+	// indistinguishable on the wire.
+	DialectGopher Dialect = iota
+
+	// GopherIIbis requests contain a format string and a data flag after the search
+	// string, or request metadata using '&' in place of the search string.
+	DialectIIbis
+
+	// Gopher+ requests contain a '+' or '$' in place of the search string, or a '+'
+	// after the search string. Gopher+ clients expect a header line before the response.
+	//
+	// Gopher+ '!' attribute requests are indistinguishable from GopherIIbis '!'
+	// metadata requests, and are reported as DialectPlus.
+	DialectPlus
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DialectGopher:
+		return "gopher"
+	case DialectIIbis:
+		return "gopher-iibis"
+	case DialectPlus:
+		return "gopher+"
+	default:
+		return "unknown"
+	}
+}
@@ -124,7 +124,7 @@ func parseDirent(txt string, line int, dir *Dirent, flag DirentFlag) error {
 				ps := strings.TrimSpace(txt[start:i])
 				if ps != "" {
 					if flag&direntNoValidatePort == 0 {
-						if _, err := strconv.ParseInt(ps, 10, 16); err != nil {
+						if _, err := strconv.ParseUint(ps, 10, 16); err != nil {
 							return fmt.Errorf("gopher: unexpected port %q at line %d: %w", ps, line, err)
 						}
 					}
@@ -59,3 +59,26 @@ func TestParseDirent(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDirentPort(t *testing.T) {
+	for idx, tc := range []struct {
+		port string
+		ok   bool
+	}{
+		{"70", true},
+		{"32768", true}, // Ephemeral ports are commonly above the int16 range
+		{"65535", true},
+		{"65536", false},
+		{"-1", false},
+		{"+70", false},
+		{"nope", false},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			var d Dirent
+			err := parseDirent("0a\tb\tc\t"+tc.port, 1, &d, 0)
+			if ok := err == nil; ok != tc.ok {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -43,6 +43,11 @@ func DetectError(data []byte, errFactory ErrFactory) *Error {
 	if bytes.HasPrefix(data, tokPlusError) {
 		status, msg, found := extractGopherIIError(data)
 		if found {
+			if status == 1 || status == 2 {
+				// Gopher+ errors are prefixed with a content length of -1 or -2 rather
+				// than a status:
+				status, msg = extractGopherPlusError(msg)
+			}
 			return errFactory(status, msg, 1)
 		} else {
 			return nil
@@ -54,10 +59,18 @@ func DetectError(data []byte, errFactory ErrFactory) *Error {
 	if (data[0] == 'i' || data[0] == '3') && firstNl > 0 {
 		status, msg, found := extractDirentError(data)
 		if found {
+			if cstatus, cmsg, ok := extractCanonicalError(msg); ok {
+				return errFactory(cstatus, cmsg, 1)
+			}
 			return errFactory(status, msg, 0.9)
 		}
 	}
 
+	// Errors sent to text clients by DefaultErrorRenderer:
+	if status, msg, ok := extractCanonicalError(string(errorTrimRightCRLF(data[:firstNl], firstNl))); ok {
+		return errFactory(status, msg, 1)
+	}
+
 	// If the first line is an 'i' line, try to check a set number of 'i' lines against the
 	// well-known error prefixes:
 	if data[0] == 'i' && firstNl > 0 {
@@ -149,6 +162,48 @@ func extractGopherIIError(data []byte) (status Status, msg string, found bool) {
 	return 0, "", false
 }
 
+// extractGopherPlusError extracts the status from the message that follows a Gopher+
+// error header, which starts with one of the three Gopher+ error codes. If the message
+// is in the form sent by DefaultErrorRenderer, the original status is used.
+func extractGopherPlusError(msg string) (status Status, out string) {
+	if len(msg) < 2 || msg[1] != ' ' {
+		return StatusGeneralError, msg
+	}
+	out = msg[2:]
+	if cstatus, cmsg, ok := extractCanonicalError(out); ok {
+		return cstatus, cmsg
+	}
+	switch msg[0] {
+	case '1':
+		return StatusNotFound, out
+	case '2':
+		return StatusUnavailable, out
+	}
+	return StatusGeneralError, msg
+}
+
+// extractCanonicalError extracts errors in the form written by DefaultErrorRenderer:
+//	Error: 404, Not found
+func extractCanonicalError(msg string) (status Status, out string, found bool) {
+	const prefix = "Error: "
+	const minLen = len(prefix) + len("000, ")
+
+	if len(msg) < minLen || msg[:len(prefix)] != prefix {
+		return 0, "", false
+	}
+	code := msg[len(prefix) : len(prefix)+3]
+	for i := 0; i < 3; i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return 0, "", false
+		}
+		status = status*10 + Status(code[i]-'0')
+	}
+	if msg[len(prefix)+3] != ',' || msg[len(prefix)+4] != ' ' {
+		return 0, "", false
+	}
+	return status, msg[minLen:], true
+}
+
 func extractDirentError(data []byte) (status Status, msg string, found bool) {
 	dsz := len(data)
 
@@ -0,0 +1,84 @@
+package gopher
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// ErrorHandlerFunc adapts a function that returns an error to a Handler, so that
+// Handlers can return errors instead of each writing their own:
+//
+//	mux.Handle("/post/:id", gopher.ErrorHandlerFunc(func(ctx context.Context, w gopher.ResponseWriter, r *gopher.Request) error {
+//		id, err := r.Params.Int("id")
+//		if err != nil {
+//			return gopher.StatusBadRequest
+//		}
+//		post, err := loadPost(id) // Missing posts return os.ErrNotExist
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}), nil)
+//
+// Errors are sent to the client with RespondErr(). If the function has already written
+// part of the response, the error is logged instead.
+type ErrorHandlerFunc func(ctx context.Context, w ResponseWriter, r *Request) error
+
+var _ Handler = ErrorHandlerFunc(nil)
+
+func (fn ErrorHandlerFunc) ServeGopher(ctx context.Context, w ResponseWriter, r *Request) {
+	tw := &trackingWriter{w: w}
+	err := fn(ctx, tw, r)
+	if err == nil {
+		return
+	}
+	if tw.n > 0 {
+		r.logger().Printf("gopher: error serving %s after response started: %v\n", r.remoteAddrString(), err)
+		return
+	}
+	if rerr := RespondErr(w, r, err); rerr != nil {
+		r.logger().Printf("gopher: error response to %s failed: %v\n", r.remoteAddrString(), rerr)
+	}
+}
+
+// RespondErr sends err to the client with RespondError(), using the Status and message
+// from ErrorStatus(). Errors with no Status are logged, as the client only sees
+// StatusInternal.
+func RespondErr(w ResponseWriter, r *Request, err error) error {
+	status, msg, ok := errorStatus(err)
+	if !ok {
+		r.logger().Printf("gopher: error serving %s: %v\n", r.remoteAddrString(), err)
+	}
+	return RespondError(w, r, status, msg)
+}
+
+// ErrorStatus finds the Status and message to send to the client for err:
+//
+//	Status (wrapped or not)    The Status, with StatusText()
+//	*Error                     Its Status and Message
+//	os.ErrNotExist             StatusNotFound
+//	os.ErrPermission           StatusForbidden
+//	Anything else              StatusInternal
+//
+// The messages of other errors are not sent to the client, as they may contain details
+// it should not see.
+func ErrorStatus(err error) (status Status, msg string) {
+	status, msg, _ = errorStatus(err)
+	return status, msg
+}
+
+func errorStatus(err error) (status Status, msg string, ok bool) {
+	var gerr *Error
+	switch {
+	case errors.As(err, &status) && status != OK:
+		return status, StatusText(status), true
+	case errors.As(err, &gerr):
+		return gerr.Status, gerr.Message, true
+	case errors.Is(err, os.ErrNotExist):
+		return StatusNotFound, StatusText(StatusNotFound), true
+	case errors.Is(err, os.ErrPermission):
+		return StatusForbidden, StatusText(StatusForbidden), true
+	}
+	return StatusInternal, StatusText(StatusInternal), false
+}
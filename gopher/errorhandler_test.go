@@ -0,0 +1,80 @@
+package gopher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestErrorStatus(t *testing.T) {
+	for idx, tc := range []struct {
+		err    error
+		status Status
+		msg    string
+	}{
+		{StatusNotFound, StatusNotFound, "Not found"},
+		{fmt.Errorf("post 1: %w", StatusGone), StatusGone, "Gone"},
+		{NewError(URL{}, StatusUnavailable, "Down for maintenance", 1), StatusUnavailable, "Down for maintenance"},
+		{fmt.Errorf("open: %w", os.ErrNotExist), StatusNotFound, "Not found"},
+		{&os.PathError{Op: "open", Path: "/secret", Err: os.ErrPermission}, StatusForbidden, "Forbidden"},
+		{errors.New("database password is hunter2"), StatusInternal, "Internal server error"},
+		{Status(999), Status(999), "Error"},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			status, msg := ErrorStatus(tc.err)
+			if status != tc.status || msg != tc.msg {
+				t.Fatal(status, msg)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerFunc(t *testing.T) {
+	var log recordLogger
+	serve := func(h ErrorHandlerFunc) string {
+		var out bytes.Buffer
+		rq := NewRequest(URL{Selector: "/foo.txt"}, nil)
+		rq.log = &log
+		h.ServeGopher(context.Background(), &out, rq)
+		return out.String()
+	}
+
+	out := serve(func(ctx context.Context, w ResponseWriter, r *Request) error {
+		return fmt.Errorf("load: %w", os.ErrNotExist)
+	})
+	if out != "Error: 404, Not found\r\n.\r\n" || len(log.lines) != 0 {
+		t.Fatalf("%q %q", out, log.lines)
+	}
+
+	out = serve(func(ctx context.Context, w ResponseWriter, r *Request) error {
+		return errors.New("secret")
+	})
+	if strings.Contains(out, "secret") || !strings.Contains(out, "500") {
+		t.Fatalf("%q", out)
+	}
+	if len(log.lines) != 1 || !strings.Contains(log.lines[0], "secret") {
+		t.Fatal(log.lines)
+	}
+
+	// Too late to send an error, so it's only logged:
+	log.lines = nil
+	out = serve(func(ctx context.Context, w ResponseWriter, r *Request) error {
+		w.Write([]byte("partial"))
+		return StatusNotFound
+	})
+	if out != "partial" || len(log.lines) != 1 {
+		t.Fatalf("%q %q", out, log.lines)
+	}
+
+	out = serve(func(ctx context.Context, w ResponseWriter, r *Request) error {
+		w.Write([]byte("ok"))
+		return nil
+	})
+	if out != "ok" {
+		t.Fatalf("%q", out)
+	}
+}
@@ -0,0 +1,135 @@
+package gopher
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrorInfo describes a protocol-level failure to be sent to the client by an
+// ErrorRenderer.
+type ErrorInfo struct {
+	Status  Status
+	Message string
+	URL     URL
+
+	// Dialect spoken by the client. GopherIIbis and Gopher+ clients expect errors in
+	// their own formats.
+	Dialect Dialect
+
+	// ItemType is a best guess at the item type the client expected to receive, as
+	// there is no way to know what the client actually expects.
+	ItemType ItemType
+}
+
+// ErrorRenderer writes errors to the client. Server uses its ErrorRenderer for every
+// error it sends, and Handlers should use RespondError() to send errors using the same
+// ErrorRenderer.
+//
+// Renderers should write errors that DetectError() can recognise, otherwise a furlib
+// Client will not be able to tell a response is an error.
+type ErrorRenderer interface {
+	RenderError(w io.Writer, info *ErrorInfo) error
+}
+
+type ErrorRendererFunc func(w io.Writer, info *ErrorInfo) error
+
+func (fn ErrorRendererFunc) RenderError(w io.Writer, info *ErrorInfo) error {
+	return fn(w, info)
+}
+
+// DefaultErrorRenderer writes errors in the following forms, each of which DetectError
+// will recognise with a confidence of 1:
+//
+//	GopherIIbis:    --404[CR][LF]Not found[CR][LF].[CR][LF]
+//	Gopher+:        --1[CR][LF]1 Error: 404, Not found[CR][LF].[CR][LF]
+//	Gopher (text):  Error: 404, Not found[CR][LF].[CR][LF]
+//	Gopher (other): 3Error: 404, Not found^I^Iinvalid^I0[CR][LF].[CR][LF]
+//
+var DefaultErrorRenderer ErrorRenderer = ErrorRendererFunc(renderError)
+
+func renderError(w io.Writer, info *ErrorInfo) error {
+	bufw := bufio.NewWriter(w)
+	msg := errorMessageClean(info.Message)
+
+	switch info.Dialect {
+	case DialectIIbis:
+		fmt.Fprintf(bufw, "--%d\r\n%s\r\n", info.Status, msg)
+
+	case DialectPlus:
+		// Gopher+ errors have a '-' header in place of the '+', followed by the
+		// Gopher+ error code and a message:
+		fmt.Fprintf(bufw, "--1\r\n%d Error: %d, %s\r\n", plusErrorCode(info.Status), info.Status, msg)
+
+	default:
+		if info.ItemType == Text {
+			fmt.Fprintf(bufw, "Error: %d, %s\r\n", info.Status, msg)
+		} else {
+			fmt.Fprintf(bufw, "%cError: %d, %s\t\tinvalid\t0\r\n", ItemError, info.Status, msg)
+		}
+	}
+
+	bufw.Write(dotTerminator)
+	return bufw.Flush()
+}
+
+// RespondError sends an error to the client using the Server's ErrorRenderer. Nothing
+// should have been written to w before calling RespondError.
+//
+// The ErrorInfo's ItemType comes from ServerResponseWriter.SetItemType() if it was
+// called, otherwise it is guessed from the selector.
+//
+// For Gopher+ requests, the error is sent in place of the Gopher+ response header, so
+// the client sees '--1' rather than a successful response containing an error.
+func RespondError(w ResponseWriter, r *Request, status Status, msg string) error {
+	if r.dialect == DialectPlus {
+		// The '--' error header takes the place of the '+' header:
+		suppressPlusHeader(w)
+	} else {
+		hintTerminated(w)
+	}
+	setResponseStatus(w, status)
+	itemType := responseItemType(w)
+	if itemType == NoItemType {
+		itemType = guessItemType(r.url)
+	}
+	info := &ErrorInfo{
+		Status:   status,
+		Message:  msg,
+		URL:      r.url,
+		Dialect:  r.dialect,
+		ItemType: itemType,
+	}
+	return r.errorRenderer().RenderError(w, info)
+}
+
+// guessItemType makes a best guess at the item type a client expects for a URL. Servers
+// always receive a URL with an ItemType of Text, which is not terribly useful.
+func guessItemType(u URL) ItemType {
+	if u.Root || u.Search != "" {
+		return Dir
+	}
+	sel := u.Selector
+	if strings.HasSuffix(sel, "/") {
+		return Dir
+	}
+	switch strings.ToLower(path.Ext(sel)) {
+	case "":
+		return Dir
+	case ".txt", ".text", ".md", ".asc", ".csv":
+		return Text
+	}
+	return Binary
+}
+
+var errorMessageReplacer = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+// errorMessageClean replaces any characters that could break the error's framing.
+func errorMessageClean(s string) string {
+	if strings.IndexAny(s, "\t\r\n") < 0 {
+		return s
+	}
+	return errorMessageReplacer.Replace(s)
+}
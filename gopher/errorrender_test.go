@@ -0,0 +1,67 @@
+package gopher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestDefaultErrorRendererDetectable(t *testing.T) {
+	for idx, tc := range []struct {
+		dialect Dialect
+		sel     string
+		msg     string
+	}{
+		{DialectGopher, "", "Not found"},
+		{DialectGopher, "foo/bar", "Not found"},
+		{DialectGopher, "foo/bar.txt", "Not found"},
+		{DialectGopher, "foo/bar.bin", "Not found"},
+		{DialectGopher, "foo/bar.txt", "Tabs\tand\r\nnewlines"},
+		{DialectIIbis, "foo", "Not found"},
+		{DialectPlus, "foo", "Not found"},
+		{DialectPlus, "foo", "Tabs\tand\r\nnewlines"},
+	} {
+		for _, status := range []Status{StatusNotFound, StatusUnavailable, StatusForbidden} {
+			t.Run(fmt.Sprintf("%d/%d", idx, status), func(t *testing.T) {
+				var buf bytes.Buffer
+				rq := NewRequest(URL{Selector: tc.sel, Root: tc.sel == ""}, nil)
+				rq.dialect = tc.dialect
+				if err := RespondError(&buf, rq, status, tc.msg); err != nil {
+					t.Fatal(err)
+				}
+
+				err := DetectError(buf.Bytes(), func(status Status, msg string, confidence float64) *Error {
+					return NewError(URL{}, status, msg, confidence)
+				})
+				if err == nil {
+					t.Fatalf("error not detected in %q", buf.String())
+				}
+				if err.Status != status || err.Confidence != 1 {
+					t.Fatal(err.Status, err.Confidence, buf.String())
+				}
+				if err.Message != errorMessageClean(tc.msg) {
+					t.Fatalf("%q", err.Message)
+				}
+			})
+		}
+	}
+}
+
+func TestServerErrorRenderer(t *testing.T) {
+	srv := &Server{
+		Handler: NewMux(),
+		ErrorRenderer: ErrorRendererFunc(func(w io.Writer, info *ErrorInfo) error {
+			_, err := fmt.Fprintf(w, "oops %d %s", info.Status, info.URL.Selector)
+			return err
+		}),
+	}
+	addr := testServe(t, srv)
+
+	if out := testRawRequest(t, addr, "nope\r\n"); out != "oops 404 nope" {
+		t.Fatalf("%q", out)
+	}
+	if out := testRawRequest(t, addr, "nope\t\t2\r\n"); out != "oops 400 nope" {
+		t.Fatalf("%q", out)
+	}
+}
@@ -0,0 +1,148 @@
+package gophertest
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func testMux() *gopher.Mux {
+	mux := gopher.NewMux()
+	mux.Handle("/", gopher.HandlerFunc(func(ctx context.Context, w gopher.ResponseWriter, r *gopher.Request) {
+		dw := gopher.NewDirWriter(w, r)
+		dw.Info("hello")
+		dw.Text("Text", "/text")
+		dw.Flush()
+	}), nil)
+	mux.Handle("/text", gopher.HandlerFunc(func(ctx context.Context, w gopher.ResponseWriter, r *gopher.Request) {
+		tw := gopher.NewTextWriter(w)
+		tw.WriteLine("yep")
+		tw.WriteLine("nope")
+		tw.Flush()
+	}), nil)
+	return mux
+}
+
+func TestServer(t *testing.T) {
+	for _, tls := range []bool{false, true} {
+		t.Run(map[bool]string{false: "plain", true: "tls"}[tls], func(t *testing.T) {
+			var srv *Server
+			if tls {
+				srv = NewTLSServer(testMux())
+			} else {
+				srv = NewServer(testMux())
+			}
+			defer srv.Close()
+
+			ctx := context.Background()
+			dir, err := srv.Client().Dir(ctx, gopher.NewRequest(srv.URL(""), nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var dirent gopher.Dirent
+			var found []string
+			for dir.Next(&dirent) {
+				found = append(found, dirent.Display)
+			}
+			if err := dir.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual([]string{"hello", "Text"}, found) {
+				t.Fatal(found)
+			}
+
+			txt, err := srv.Client().Text(ctx, gopher.NewRequest(srv.URL("/text"), nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer txt.Close()
+			b, err := ioutil.ReadAll(txt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "yep\nnope\n" {
+				t.Fatalf("%q", b)
+			}
+		})
+	}
+}
+
+func TestRecorderDirents(t *testing.T) {
+	rec := NewRecorder()
+	testMux().ServeGopher(context.Background(), rec, NewRequest("", ""))
+
+	dirents, err := rec.Dirents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirents) != 2 || dirents[0].ItemType != gopher.Info || dirents[1].Selector != "/text" {
+		t.Fatal(dirents)
+	}
+	if dirents[1].Hostname != Hostname || dirents[1].Port != Port {
+		t.Fatal(dirents[1])
+	}
+	if rec.ItemType() != gopher.Dir {
+		t.Fatal(rec.ItemType())
+	}
+}
+
+func TestRecorderText(t *testing.T) {
+	rec := NewRecorder()
+	testMux().ServeGopher(context.Background(), rec, NewRequest("/text", ""))
+
+	txt, err := rec.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txt != "yep\nnope\n" {
+		t.Fatalf("%q", txt)
+	}
+	if rec.ItemType() != gopher.Text {
+		t.Fatal(rec.ItemType())
+	}
+}
+
+func TestRecorderErr(t *testing.T) {
+	rec := NewRecorder()
+	testMux().ServeGopher(context.Background(), rec, NewRequest("/nope", ""))
+
+	err := rec.Err()
+	if err == nil || err.Status != gopher.StatusNotFound {
+		t.Fatal(err, rec.Body.String())
+	}
+	if rec.Status() != gopher.StatusNotFound {
+		t.Fatal(rec.Status())
+	}
+}
+
+func TestNewMetaRequest(t *testing.T) {
+	rq := NewMetaRequest("/text", "ABSTRACT")
+	if rq.RemoteAddr != RemoteAddr {
+		t.Fatal(rq.RemoteAddr)
+	}
+	if u := rq.URL(); u.Selector != "/text" || u.Search != "!+ABSTRACT" || !u.IsMeta() {
+		t.Fatal(u)
+	}
+}
+
+func TestRecorderMeta(t *testing.T) {
+	rq := NewMetaRequest("/text")
+	rec := NewRecorder()
+	mw := rec.MetaWriter(rq)
+	mw.Info(gopher.Text, "Text", "/text")
+	mw.WriteRecord("ABSTRACT", "line 1\nline 2")
+
+	entries, err := rec.Meta()
+	if err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if len(entries) != 2 {
+		t.Fatal(entries)
+	}
+	if entries[0].Record != "INFO" || entries[1] != (gopher.MetaEntry{Record: "ABSTRACT", Value: "line 1\nline 2"}) {
+		t.Fatal(entries)
+	}
+}
@@ -0,0 +1,169 @@
+package gophertest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// ResponseRecorder is a gopher.ServerResponseWriter that records what a Handler writes,
+// and parses it for assertions:
+//
+//	rec := gophertest.NewRecorder()
+//	handler.ServeGopher(ctx, rec, gophertest.NewRequest("/", ""))
+//
+//	dirents, err := rec.Dirents()
+//
+// For a MetaHandler, pass the MetaWriter from rec.MetaWriter() instead, then use
+// rec.Meta().
+type ResponseRecorder struct {
+	// Body holds everything written to the ResponseRecorder.
+	Body *bytes.Buffer
+
+	// Flushed is set if Flush() was called.
+	Flushed bool
+
+	status   gopher.Status
+	itemType gopher.ItemType
+	meta     gopher.MetaWriter
+	closed   chan struct{}
+}
+
+var _ gopher.ServerResponseWriter = &ResponseRecorder{}
+
+// NewRecorder returns an empty ResponseRecorder.
+func NewRecorder() *ResponseRecorder {
+	return &ResponseRecorder{
+		Body:   new(bytes.Buffer),
+		closed: make(chan struct{}),
+	}
+}
+
+func (rec *ResponseRecorder) Write(b []byte) (int, error) {
+	return rec.Body.Write(b)
+}
+
+func (rec *ResponseRecorder) Written() int64                { return int64(rec.Body.Len()) }
+func (rec *ResponseRecorder) Status() gopher.Status         { return rec.status }
+func (rec *ResponseRecorder) SetStatus(s gopher.Status)     { rec.status = s }
+func (rec *ResponseRecorder) ItemType() gopher.ItemType     { return rec.itemType }
+func (rec *ResponseRecorder) SetItemType(i gopher.ItemType) { rec.itemType = i }
+
+func (rec *ResponseRecorder) Flush() error {
+	rec.Flushed = true
+	return nil
+}
+
+// Hijack always fails, as there is no connection to take over.
+func (rec *ResponseRecorder) Hijack() (net.Conn, error) {
+	return nil, errors.New("gophertest: ResponseRecorder can't be hijacked")
+}
+
+// CloseNotify returns a channel that is closed by CloseClient().
+func (rec *ResponseRecorder) CloseNotify() <-chan struct{} {
+	return rec.closed
+}
+
+// CloseClient pretends the client has gone away, closing the channel returned by
+// CloseNotify().
+func (rec *ResponseRecorder) CloseClient() {
+	select {
+	case <-rec.closed:
+	default:
+		close(rec.closed)
+	}
+}
+
+// MetaWriter returns a MetaWriter for rq that writes to the ResponseRecorder. rq must
+// be a meta request; see NewMetaRequest().
+func (rec *ResponseRecorder) MetaWriter(rq *gopher.Request) gopher.MetaWriter {
+	rec.meta = gopher.NewMetaWriter(rec, rq)
+	return rec.meta
+}
+
+// Text returns the Body as a dot-terminated text response, with the terminator removed,
+// lines starting with '..' unescaped, and CRLF line endings replaced with LF.
+func (rec *ResponseRecorder) Text() (string, error) {
+	b, err := ioutil.ReadAll(gopher.NewTextReader(bytes.NewReader(rec.Body.Bytes())))
+	return string(b), err
+}
+
+// Dirents parses the Body as a directory.
+func (rec *ResponseRecorder) Dirents() ([]gopher.Dirent, error) {
+	var dirents []gopher.Dirent
+	rdr := gopher.NewDirReader(bytes.NewReader(rec.Body.Bytes()))
+	for {
+		var dirent gopher.Dirent
+		if !rdr.Read(&dirent) {
+			break
+		}
+		dirents = append(dirents, dirent)
+	}
+	return dirents, rdr.ReadErr()
+}
+
+// Meta flushes the MetaWriter returned by MetaWriter(), as a Server would when the
+// MetaHandler returns, then parses the Body as a metadata listing. The value of each
+// record has its line endings replaced with LF, and surrounding whitespace trimmed.
+// INFO records are included.
+func (rec *ResponseRecorder) Meta() ([]gopher.MetaEntry, error) {
+	if rec.meta != nil {
+		if err := rec.meta.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []gopher.MetaEntry
+	var value strings.Builder
+	end := func() {
+		if n := len(entries); n > 0 {
+			entries[n-1].Value = strings.TrimSpace(value.String())
+		}
+		value.Reset()
+	}
+
+	scn := bufio.NewScanner(gopher.NewTextReader(bytes.NewReader(rec.Body.Bytes())))
+	for line := 0; scn.Scan(); line++ {
+		txt := scn.Text()
+		if line == 0 {
+			if txt != "+-1" {
+				return nil, errors.New("gophertest: metadata listing did not start with '+-1'")
+			}
+			continue
+		}
+
+		if strings.HasPrefix(txt, "+") {
+			end()
+			record := txt[1:]
+			var first string
+			if colon := strings.IndexByte(record, ':'); colon >= 0 {
+				record, first = record[:colon], strings.TrimSpace(record[colon+1:])
+			}
+			entries = append(entries, gopher.MetaEntry{Record: record})
+			value.WriteString(first)
+			continue
+		}
+
+		if len(entries) == 0 {
+			return nil, errors.New("gophertest: metadata value found before first record")
+		}
+		if value.Len() > 0 {
+			value.WriteByte('\n')
+		}
+		value.WriteString(txt)
+	}
+	end()
+	return entries, scn.Err()
+}
+
+// Err returns the error sent by the Handler, if DetectError() finds one in the Body.
+func (rec *ResponseRecorder) Err() *gopher.Error {
+	return gopher.DetectError(rec.Body.Bytes(), func(status gopher.Status, msg string, confidence float64) *gopher.Error {
+		return gopher.NewError(gopher.URL{}, status, msg, confidence)
+	})
+}
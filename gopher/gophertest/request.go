@@ -0,0 +1,42 @@
+package gophertest
+
+import (
+	"net"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Hostname and Port of the URL of Requests created by NewRequest().
+const (
+	Hostname = "localhost"
+	Port     = "70"
+)
+
+// RemoteAddr is the RemoteAddr of Requests created by NewRequest(). It is in the
+// TEST-NET-1 range from RFC 5737.
+var RemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234}
+
+// NewRequest returns a Request for sel and search, as a Server would pass it to a
+// Handler. An empty selector is the root.
+func NewRequest(sel, search string) *gopher.Request {
+	return newRequest(gopher.URL{
+		Hostname: Hostname,
+		Port:     Port,
+		ItemType: gopher.Text,
+		Selector: sel,
+		Search:   search,
+		Root:     sel == "",
+	})
+}
+
+// NewMetaRequest returns a meta Request for the metadata of sel, as a Server would
+// pass it to a MetaHandler. If records are given, only those records are requested.
+func NewMetaRequest(sel string, records ...string) *gopher.Request {
+	return newRequest(NewRequest(sel, "").URL().AsMetaItem(records...))
+}
+
+func newRequest(u gopher.URL) *gopher.Request {
+	rq := gopher.NewRequest(u, nil)
+	rq.RemoteAddr = RemoteAddr
+	return rq
+}
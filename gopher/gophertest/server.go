@@ -0,0 +1,145 @@
+package gophertest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Server is a gopher.Server listening on a random port on the loopback interface, for
+// use in end-to-end tests:
+//
+//	srv := gophertest.NewServer(mux)
+//	defer srv.Close()
+//
+//	rs, err := srv.Client().Dir(ctx, gopher.NewRequest(srv.URL("/"), nil))
+type Server struct {
+	// Addr is the address the Server is listening on, i.e. '127.0.0.1:49152'.
+	Addr string
+
+	// Config may be changed after NewUnstartedServer() and before Start() or
+	// StartTLS(). Config.Handler is the Handler passed to the constructor.
+	Config *gopher.Server
+
+	// Certificate is the Server's generated certificate, if it was started with
+	// StartTLS().
+	Certificate *x509.Certificate
+
+	ln     net.Listener
+	done   chan struct{}
+	client *gopher.Client
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when
+// finished, to shut it down.
+func NewServer(h gopher.Handler) *Server {
+	srv := NewUnstartedServer(h)
+	srv.Start()
+	return srv
+}
+
+// NewTLSServer starts and returns a new Server using TLS, with a certificate generated
+// for the loopback interface. Client() returns a Client that trusts it.
+func NewTLSServer(h gopher.Handler) *Server {
+	srv := NewUnstartedServer(h)
+	srv.StartTLS()
+	return srv
+}
+
+// NewUnstartedServer returns a new Server that is not yet listening. Change its Config
+// if needed, then call Start() or StartTLS().
+func NewUnstartedServer(h gopher.Handler) *Server {
+	return &Server{
+		Config: &gopher.Server{Handler: h},
+	}
+}
+
+// Start starts the Server without TLS.
+func (s *Server) Start() {
+	if s.ln != nil {
+		panic("gophertest: server already started")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		if ln, err = net.Listen("tcp6", "[::1]:0"); err != nil {
+			panic(fmt.Errorf("gophertest: failed to listen on a port: %w", err))
+		}
+	}
+	s.ln = ln
+	s.Addr = ln.Addr().String()
+	s.client = &gopher.Client{TLSMode: gopher.TLSDisabled}
+
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		s.Config.Serve(ln, "")
+	}()
+}
+
+// StartTLS starts the Server with TLS. If Config.TLSConfig has no certificates, a
+// certificate is generated for the loopback interface.
+func (s *Server) StartTLS() {
+	cert := generatedCert()
+
+	conf := s.Config.TLSConfig
+	if conf == nil {
+		conf = &tls.Config{}
+	} else {
+		conf = conf.Clone()
+	}
+	if len(conf.Certificates) == 0 {
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	s.Config.TLSConfig = conf
+
+	leaf, err := x509.ParseCertificate(conf.Certificates[0].Certificate[0])
+	if err != nil {
+		panic(fmt.Errorf("gophertest: invalid certificate: %w", err))
+	}
+	s.Certificate = leaf
+
+	s.Start()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	s.client = &gopher.Client{
+		TLSMode:         gopher.TLSInsist,
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}
+}
+
+// Client returns a Client configured to make requests to the Server. If the Server
+// uses TLS, the Client trusts its certificate and won't fall back to plain text.
+func (s *Server) Client() *gopher.Client {
+	return s.client
+}
+
+// URL returns a URL for sel on the Server. An empty selector is the root.
+func (s *Server) URL(sel string) gopher.URL {
+	host, port, _ := net.SplitHostPort(s.Addr)
+	u := gopher.URL{
+		Scheme:   "gopher",
+		Hostname: host,
+		Port:     port,
+		ItemType: gopher.Text,
+		Selector: sel,
+		Root:     sel == "",
+	}
+	if s.Certificate != nil {
+		u.Scheme = "gophers"
+	}
+	return u
+}
+
+// Close shuts down the Server, and waits for it to stop accepting connections.
+func (s *Server) Close() {
+	if s.ln == nil {
+		return
+	}
+	s.Config.Close()
+	<-s.done
+}
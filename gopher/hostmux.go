@@ -0,0 +1,173 @@
+package gopher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// VirtualHost is a site served by a HostMux.
+type VirtualHost struct {
+	Handler Handler
+
+	// If nil but Handler implements MetaHandler, Handler is used as the MetaHandler.
+	MetaHandler MetaHandler
+
+	// Info for the site, available to Handlers with VirtualHostFromContext().
+	Info *ServerInfo
+
+	// SelectorPrefix replaces the Server's SelectorPrefix for requests to this site.
+	SelectorPrefix string
+
+	// Hostname and Port replace the Request's URL.Hostname and URL.Port, so writers like
+	// DirWriter emit the site's own host for its items. If Hostname is empty, the name
+	// the site was registered with in HostMux.Handle() is used; if Port is empty, the
+	// port the request was received on is kept.
+	Hostname string
+	Port     string
+}
+
+func (vh *VirtualHost) metaHandler() MetaHandler {
+	if vh.MetaHandler != nil {
+		return vh.MetaHandler
+	}
+	mh, _ := vh.Handler.(MetaHandler)
+	return mh
+}
+
+type virtualHostKey struct{}
+
+// VirtualHostFromContext returns the VirtualHost chosen by a HostMux for the current
+// request, or nil if the request was not served by a HostMux.
+func VirtualHostFromContext(ctx context.Context) *VirtualHost {
+	vh, _ := ctx.Value(virtualHostKey{}).(*VirtualHost)
+	return vh
+}
+
+// HostMux dispatches requests to a VirtualHost by the host name the client asked for,
+// so one Server can host several sites.
+//
+// Gopher requests do not carry a host name, so it must come from somewhere else; see
+// RequestHost. Requests with no host name, or a host name that does not match a site,
+// are sent to Default. If Default is nil, they receive a StatusNotFound error.
+//
+//	hm := gopher.NewHostMux(&gopher.VirtualHost{Handler: defaultMux})
+//	hm.Handle("foo.example.com", &gopher.VirtualHost{Handler: fooMux})
+//	hm.Handle("bar.example.com", &gopher.VirtualHost{Handler: barMux, Port: "7070"})
+//	srv := &gopher.Server{Handler: hm, TLSConfig: tlsConfig}
+type HostMux struct {
+	Default *VirtualHost
+
+	hosts map[string]*VirtualHost
+}
+
+var (
+	_ Handler     = &HostMux{}
+	_ MetaHandler = &HostMux{}
+)
+
+func NewHostMux(def *VirtualHost) *HostMux {
+	return &HostMux{Default: def, hosts: make(map[string]*VirtualHost)}
+}
+
+// Handle serves requests for host with vh. Host names are not case sensitive.
+//
+// Calling Handle() twice with the same host will result in a panic.
+func (hm *HostMux) Handle(host string, vh *VirtualHost) {
+	if vh == nil || vh.Handler == nil {
+		panic(fmt.Errorf("gopher: virtual host %q has no handler", host))
+	}
+	host = normalizeHost(host)
+	if host == "" {
+		panic(fmt.Errorf("gopher: virtual host name is empty"))
+	}
+	if hm.hosts == nil {
+		hm.hosts = make(map[string]*VirtualHost)
+	}
+	if _, ok := hm.hosts[host]; ok {
+		panic(fmt.Errorf("gopher: virtual host %q already exists", host))
+	}
+	if vh.Hostname == "" {
+		vh2 := *vh
+		vh2.Hostname = host
+		vh = &vh2
+	}
+	hm.hosts[host] = vh
+}
+
+// Host returns the VirtualHost that will serve r, or nil if there isn't one.
+func (hm *HostMux) Host(r *Request) *VirtualHost {
+	if host := RequestHost(r); host != "" {
+		if vh, ok := hm.hosts[normalizeHost(host)]; ok {
+			return vh
+		}
+	}
+	return hm.Default
+}
+
+func (hm *HostMux) route(ctx context.Context, r *Request) (context.Context, *Request, *VirtualHost) {
+	vh := hm.Host(r)
+	if vh == nil {
+		return ctx, r, nil
+	}
+
+	r2 := *r
+	if vh.Hostname != "" {
+		r2.url.Hostname = vh.Hostname
+	}
+	if vh.Port != "" {
+		r2.url.Port = vh.Port
+	}
+	if vh.SelectorPrefix != "" {
+		r2.SelectorPrefix = vh.SelectorPrefix
+	}
+	return context.WithValue(ctx, virtualHostKey{}, vh), &r2, vh
+}
+
+func (hm *HostMux) ServeGopher(ctx context.Context, w ResponseWriter, r *Request) {
+	ctx, r2, vh := hm.route(ctx, r)
+	if vh == nil {
+		NotFound(w, r)
+		return
+	}
+	vh.Handler.ServeGopher(ctx, w, r2)
+}
+
+func (hm *HostMux) ServeGopherMeta(ctx context.Context, w MetaWriter, r *Request) {
+	ctx, r2, vh := hm.route(ctx, r)
+	var meta MetaHandler
+	if vh != nil {
+		meta = vh.metaHandler()
+	}
+	if meta == nil {
+		w.MetaError(StatusNotFound, "Not found: "+r.url.Selector)
+		return
+	}
+	meta.ServeGopherMeta(ctx, w, r2)
+}
+
+// RequestHost returns the host name the client asked for, if it is known. This comes
+// from the TLS Server Name Indication if the request was received over TLS, or the
+// authority sent by the proxy if the connection was accepted by a ProxyListener.
+// If neither is available, RequestHost returns an empty string.
+func RequestHost(r *Request) string {
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		return r.TLS.ServerName
+	}
+	if r.Proxy != nil {
+		if host := r.Proxy.Authority(); host != "" {
+			return host
+		}
+	}
+	return ""
+}
+
+// normalizeHost lower-cases host, and strips the port and trailing dot if present.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+	return strings.ToLower(host)
+}
@@ -0,0 +1,83 @@
+package gopher
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testHostHandler(name string) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		dw := NewDirWriter(w, r)
+		dw.Info(name)
+		dw.Dir("Sub", "/sub")
+		dw.MustFlush()
+	})
+}
+
+func TestHostMux(t *testing.T) {
+	hm := NewHostMux(&VirtualHost{Handler: testHostHandler("default")})
+	hm.Handle("Foo.Example.com", &VirtualHost{Handler: testHostHandler("foo"), SelectorPrefix: "/foo"})
+	hm.Handle("bar.example.com", &VirtualHost{Handler: testHostHandler("bar"), Hostname: "gopher.bar.example.com", Port: "7070"})
+
+	for idx, tc := range []struct {
+		sni   string
+		proxy string
+		out   string
+	}{
+		{"", "", "idefault\tnull\tinvalid\t0\r\n1Sub\t/sub\tlocalhost\t70\r\n.\r\n"},
+		{"nope.example.com", "", "idefault\tnull\tinvalid\t0\r\n1Sub\t/sub\tlocalhost\t70\r\n.\r\n"},
+		{"foo.example.com", "", "ifoo\tnull\tinvalid\t0\r\n1Sub\t/foo/sub\tfoo.example.com\t70\r\n.\r\n"},
+		{"FOO.example.com.", "", "ifoo\tnull\tinvalid\t0\r\n1Sub\t/foo/sub\tfoo.example.com\t70\r\n.\r\n"},
+		{"", "bar.example.com:70", "ibar\tnull\tinvalid\t0\r\n1Sub\t/sub\tgopher.bar.example.com\t7070\r\n.\r\n"},
+		{"foo.example.com", "bar.example.com", "ifoo\tnull\tinvalid\t0\r\n1Sub\t/foo/sub\tfoo.example.com\t70\r\n.\r\n"},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			rq := NewRequest(URL{Hostname: "localhost", Port: "70", ItemType: Dir, Root: true}, nil)
+			if tc.sni != "" {
+				rq.TLS = &tls.ConnectionState{ServerName: tc.sni}
+			}
+			if tc.proxy != "" {
+				rq.Proxy = &ProxyHeader{TLVs: []ProxyTLV{{Type: ProxyTLVAuthority, Value: []byte(tc.proxy)}}}
+			}
+
+			var out strings.Builder
+			hm.ServeGopher(context.Background(), &out, rq)
+			if out.String() != tc.out {
+				t.Fatalf("%q", out.String())
+			}
+		})
+	}
+}
+
+func TestHostMuxNoDefault(t *testing.T) {
+	hm := NewHostMux(nil)
+	hm.Handle("foo.example.com", &VirtualHost{Handler: testHostHandler("foo")})
+
+	var out strings.Builder
+	hm.ServeGopher(context.Background(), &out, NewRequest(URL{Hostname: "localhost", Port: "70"}, nil))
+	if !strings.HasPrefix(out.String(), "3") {
+		t.Fatalf("%q", out.String())
+	}
+}
+
+func TestHostMuxContext(t *testing.T) {
+	info := &ServerInfo{Description: "foo"}
+	var found *VirtualHost
+	hm := NewHostMux(nil)
+	hm.Handle("foo.example.com", &VirtualHost{
+		Info: info,
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			found = VirtualHostFromContext(ctx)
+		}),
+	})
+
+	rq := NewRequest(URL{}, nil)
+	rq.TLS = &tls.ConnectionState{ServerName: "foo.example.com"}
+	hm.ServeGopher(context.Background(), &strings.Builder{}, rq)
+	if found == nil || found.Info != info {
+		t.Fatal(found)
+	}
+}
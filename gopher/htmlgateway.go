@@ -0,0 +1,286 @@
+package gopher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const DefaultHTMLGatewayMaxResponseSize = 16 << 20
+
+var errGatewayResponseTooLarge = errors.New("gopher: gateway response too large")
+
+// HTMLGateway is an http.Handler that serves a gopher Handler to web browsers. It is
+// intended to be used as a Server's HTTPHandler, so that browsers pointed at the gopher
+// port get a usable page:
+//
+//	srv.HTTPHandler = &gopher.HTMLGateway{Handler: srv.Handler}
+//
+// HTTP paths map to gopher items in the same way as the path of a gopher:// URL: the
+// first character is the item type, and the rest is the selector. '/' is the root
+// directory. Search items take the search from the 'q' query parameter.
+//
+// Directories are rendered as HTML, text items as text/plain, and everything else is
+// sent as-is. The gopher Handler's response is buffered in full before it is sent.
+//
+// The Request passed to the Handler has the RemoteAddr and TLS state of the HTTP
+// request, so Handlers like AccessControl() treat both protocols alike.
+type HTMLGateway struct {
+	Handler Handler
+
+	// Hostname and Port of the gopher server, used to decide which links in directories
+	// point back to this server. If empty, and the gateway is being used as a Server's
+	// HTTPHandler, the Server's host is used.
+	Hostname string
+	Port     string
+
+	// SelectorPrefix to pass to the Handler. If empty, and the gateway is being used as
+	// a Server's HTTPHandler, the Server's SelectorPrefix is used.
+	SelectorPrefix string
+
+	// Maximum size of the gopher response. If zero, DefaultHTMLGatewayMaxResponseSize
+	// is used.
+	MaxResponseSize int64
+}
+
+var _ http.Handler = &HTMLGateway{}
+
+func (gw *HTMLGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	host := gw.host(r.Context())
+	gu := URL{Hostname: host.hostname, Port: host.port, ItemType: Dir, Root: true}
+
+	p := r.URL.Path
+	if p != "" && p != "/" {
+		gu.ItemType = ItemType(p[1])
+		gu.Selector = p[2:]
+		gu.Root = false
+	}
+
+	if gu.ItemType == Search {
+		gu.Search = r.URL.Query().Get("q")
+		if gu.Search == "" {
+			gw.renderSearchForm(w, r)
+			return
+		}
+	}
+
+	rq := NewRequest(gu, nil)
+	rq.SelectorPrefix = host.selectorPrefix
+	rq.RemoteAddr = parseHTTPRemoteAddr(r.RemoteAddr)
+	rq.TLS = r.TLS
+	if rq.TLS == nil {
+		rq.TLS = host.tls
+	}
+
+	var buf = &limitedBuffer{max: gw.maxResponseSize()}
+	gstatus, err := gw.serveGopher(r.Context(), buf, rq)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == errGatewayResponseTooLarge {
+			status = http.StatusBadGateway
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	status := httpStatus(gstatus)
+	data := buf.Bytes()
+
+	switch gu.ItemType {
+	case Dir, Search:
+		var out bytes.Buffer
+		gw.renderDir(&out, host, rq.url, data)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write(out.Bytes())
+
+	case Text:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		io.Copy(w, NewTextReader(bytes.NewReader(data)))
+
+	default:
+		ctype := mime.TypeByExtension(path.Ext(gu.Selector))
+		if ctype == "" {
+			ctype = http.DetectContentType(data)
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.WriteHeader(status)
+		w.Write(data)
+	}
+}
+
+func (gw *HTMLGateway) serveGopher(ctx context.Context, buf *limitedBuffer, rq *Request) (status Status, err error) {
+	tw := &trackingWriter{w: buf}
+	defer func() {
+		if r := recover(); r != nil {
+			if rerr, ok := r.(error); ok && errors.Is(rerr, errGatewayResponseTooLarge) {
+				err = errGatewayResponseTooLarge
+			} else {
+				err = fmt.Errorf("gopher: gateway handler panicked: %v", r)
+			}
+		}
+	}()
+	gw.Handler.ServeGopher(ctx, tw, rq)
+	if buf.exceeded {
+		return tw.status, errGatewayResponseTooLarge
+	}
+	return tw.status, nil
+}
+
+func (gw *HTMLGateway) host(ctx context.Context) httpGopherHost {
+	host, _ := ctx.Value(httpGopherHostKey{}).(httpGopherHost)
+	if gw.Hostname != "" {
+		host.hostname, host.port = gw.Hostname, gw.Port
+	}
+	if gw.SelectorPrefix != "" {
+		host.selectorPrefix = gw.SelectorPrefix
+	}
+	return host
+}
+
+// parseHTTPRemoteAddr parses http.Request.RemoteAddr, which is an 'IP:port' for
+// requests received by an http.Server. It returns nil if addr is anything else.
+func parseHTTPRemoteAddr(addr string) *net.TCPAddr {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	pn, _ := strconv.Atoi(port)
+	return &net.TCPAddr{IP: ip, Port: pn}
+}
+
+func (gw *HTMLGateway) maxResponseSize() int64 {
+	if gw.MaxResponseSize > 0 {
+		return gw.MaxResponseSize
+	}
+	return DefaultHTMLGatewayMaxResponseSize
+}
+
+const htmlGatewayHeader = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>%s</title></head>
+<body><pre>
+`
+
+const htmlGatewayFooter = `</pre></body></html>
+`
+
+func (gw *HTMLGateway) renderSearchForm(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, htmlGatewayHeader, "Search")
+	fmt.Fprintf(w, "<form method=\"get\" action=\"%s\"><input name=\"q\"> <button>Search</button></form>\n",
+		html.EscapeString(r.URL.EscapedPath()))
+	io.WriteString(w, htmlGatewayFooter)
+}
+
+func (gw *HTMLGateway) renderDir(out *bytes.Buffer, host httpGopherHost, u URL, data []byte) {
+	fmt.Fprintf(out, htmlGatewayHeader, html.EscapeString(u.Selector))
+
+	dr := NewDirReader(bytes.NewReader(data))
+	dr.Flag = DirentHostOptional
+
+	var dirent Dirent
+	for dr.Read(&dirent) {
+		disp := html.EscapeString(dirent.Display)
+
+		switch dirent.ItemType {
+		case Info:
+			out.WriteString(disp)
+		case ItemError:
+			out.WriteString("<strong>" + disp + "</strong>")
+
+		default:
+			if href, ok := gw.direntHref(host, &dirent); ok {
+				fmt.Fprintf(out, "<a href=\"%s\">%s</a>", html.EscapeString(href), disp)
+			} else {
+				out.WriteString(disp)
+			}
+		}
+		out.WriteByte('\n')
+	}
+	if err := dr.ReadErr(); err != nil {
+		fmt.Fprintf(out, "\n<strong>%s</strong>\n", html.EscapeString(err.Error()))
+	}
+
+	out.WriteString(htmlGatewayFooter)
+}
+
+// direntHref builds the link for a Dirent. Items on this server link back through the
+// gateway, everything else links to the real thing.
+//
+// 'URL:' links only get an href if they use one of wwwSchemes; anything else, i.e.
+// 'javascript:', would run on the gateway's origin.
+func (gw *HTMLGateway) direntHref(host httpGopherHost, dirent *Dirent) (href string, ok bool) {
+	if www, ok := dirent.WWW(); ok {
+		u, err := url.Parse(www)
+		if err != nil || !wwwSchemes[u.Scheme] {
+			return "", false
+		}
+		return www, true
+	}
+
+	switch dirent.ItemType {
+	case Telnet, TN3270, SSH:
+		return "", false
+	}
+
+	local := dirent.Hostname == "" ||
+		(strings.EqualFold(dirent.Hostname, host.hostname) && (dirent.Port == host.port || dirent.Port == ""))
+	if local {
+		return (&url.URL{Path: "/" + string(dirent.ItemType) + dirent.Selector}).EscapedPath(), true
+	}
+	return dirent.URL().String(), true
+}
+
+var wwwSchemes = map[string]bool{"http": true, "https": true, "gopher": true, "gophers": true}
+
+// httpStatus converts a gopher Status to the closest HTTP status code.
+func httpStatus(status Status) int {
+	switch {
+	case status == OK:
+		return http.StatusOK
+	case status >= 400 && status < 600 && http.StatusText(int(status)) != "":
+		return int(status)
+	case status >= 400 && status < 500:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// limitedBuffer is a buffer that fails writes once max is exceeded.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int64
+	exceeded bool
+}
+
+func (lb *limitedBuffer) Bytes() []byte { return lb.buf.Bytes() }
+
+func (lb *limitedBuffer) Write(b []byte) (int, error) {
+	if int64(lb.buf.Len()+len(b)) > lb.max {
+		lb.exceeded = true
+		return 0, errGatewayResponseTooLarge
+	}
+	return lb.buf.Write(b)
+}
@@ -0,0 +1,133 @@
+package gopher
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var errSniffedHTTP = errors.New("gopher: request is http")
+
+// isHTTPRequestLine reports whether line looks like an HTTP/1.x request line, i.e.
+// 'GET / HTTP/1.1'. This is not a valid gopher selector in any server we know of.
+func isHTTPRequestLine(line []byte) bool {
+	sp := bytes.IndexByte(line, ' ')
+	if sp < 3 || sp > 7 {
+		return false
+	}
+	for _, c := range line[:sp] {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+
+	rest := line[sp+1:]
+	sp = bytes.IndexByte(rest, ' ')
+	if sp < 1 {
+		return false
+	}
+	proto := rest[sp+1:]
+	return bytes.Equal(proto, []byte("HTTP/1.0")) || bytes.Equal(proto, []byte("HTTP/1.1"))
+}
+
+type httpGopherHostKey struct{}
+
+// httpGopherHost is added to the context of HTTP requests handed off by the Server, so
+// that HTMLGateway can build links to the right place without extra config.
+type httpGopherHost struct {
+	hostname       string
+	port           string
+	selectorPrefix string
+	tls            *tls.ConnectionState // http.Server can't see through bufferedConn
+}
+
+// serveHTTP hands the connection to the Server's HTTPHandler. data contains the bytes
+// already read from the connection, which are replayed to the http.Server.
+func (c *serveConn) serveHTTP(data []byte) {
+	conn := &bufferedConn{
+		Conn: c.rwc,
+		rdr:  io.MultiReader(bytes.NewReader(data), c.rwc),
+	}
+
+	// The http.Server sets its own deadlines:
+	c.rwc.SetDeadline(time.Time{})
+
+	host := httpGopherHost{hostname: c.host, port: c.port, selectorPrefix: c.srv.SelectorPrefix}
+	if tc, ok := c.rwc.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		host.tls = &state
+	}
+	hs := &http.Server{
+		Handler:           c.srv.HTTPHandler,
+		ReadHeaderTimeout: c.srv.readSelectorTimeout(),
+		ReadTimeout:       c.srv.readTimeout(),
+		WriteTimeout:      c.srv.WriteTimeout,
+		IdleTimeout:       c.srv.readTimeout(),
+		ErrorLog:          log.New(&logWriter{c.log}, "", 0),
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), httpGopherHostKey{}, host)
+		},
+	}
+
+	// Otherwise one accepted connection could make any number of requests without
+	// passing through MaxConns or the RateLimiter again:
+	hs.SetKeepAlivesEnabled(false)
+
+	hs.Serve(newOneConnListener(conn))
+}
+
+// logWriter adapts a Logger to an io.Writer for use with log.Logger.
+type logWriter struct {
+	log Logger
+}
+
+func (lw *logWriter) Write(b []byte) (int, error) {
+	lw.log.Printf("%s", b)
+	return len(b), nil
+}
+
+// oneConnListener is a net.Listener that returns a single connection from Accept. The
+// next call to Accept blocks until that connection is closed, then returns io.EOF, so
+// that http.Server.Serve() returns when it is done with the connection.
+type oneConnListener struct {
+	conn   net.Conn
+	once   sync.Once
+	closed chan struct{}
+	taken  bool
+}
+
+func newOneConnListener(conn net.Conn) *oneConnListener {
+	ln := &oneConnListener{closed: make(chan struct{})}
+	ln.conn = &closeNotifyConn{Conn: conn, ln: ln}
+	return ln
+}
+
+func (ln *oneConnListener) Accept() (net.Conn, error) {
+	if !ln.taken {
+		ln.taken = true
+		return ln.conn, nil
+	}
+	<-ln.closed
+	return nil, io.EOF
+}
+
+func (ln *oneConnListener) Close() error   { return nil }
+func (ln *oneConnListener) Addr() net.Addr { return ln.conn.LocalAddr() }
+
+type closeNotifyConn struct {
+	net.Conn
+	ln *oneConnListener
+}
+
+func (cc *closeNotifyConn) Close() error {
+	err := cc.Conn.Close()
+	cc.ln.once.Do(func() { close(cc.ln.closed) })
+	return err
+}
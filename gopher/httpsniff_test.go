@@ -0,0 +1,236 @@
+package gopher
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsHTTPRequestLine(t *testing.T) {
+	for idx, tc := range []struct {
+		in string
+		ok bool
+	}{
+		{"GET / HTTP/1.1", true},
+		{"GET / HTTP/1.0", true},
+		{"HEAD /foo?bar HTTP/1.1", true},
+		{"OPTIONS * HTTP/1.1", true},
+		{"GET / HTTP/2.0", false},
+		{"GET /", false},
+		{"get / HTTP/1.1", false},
+		{"GET  HTTP/1.1", false},
+		{"/GET / HTTP/1.1", false},
+		{"", false},
+		{"/docs", false},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			if ok := isHTTPRequestLine([]byte(tc.in)); ok != tc.ok {
+				t.Fatal(ok)
+			}
+		})
+	}
+}
+
+func testGatewayMux() *Mux {
+	mux := NewMux()
+	mux.Handle("/", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		dw := NewDirWriter(w, r)
+		dw.Info("Hello <world>")
+		dw.Text("Read me", "/readme.txt")
+		dw.Dir("Sub", "/sub dir/")
+		dw.RemoteSelector(Dir, "Elsewhere", "/x", "example.com", 70)
+		dw.MustFlush()
+	}), nil)
+	mux.Handle("/readme.txt", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		tw := NewTextWriter(w)
+		tw.WriteString("line\r\nmore\r\n")
+		tw.MustFlush()
+	}), nil)
+	return mux
+}
+
+func TestServerHTTPSniff(t *testing.T) {
+	mux := testGatewayMux()
+	srv := &Server{Handler: mux}
+	srv.HTTPHandler = &HTMLGateway{Handler: mux}
+	addr := testServe(t, srv)
+
+	// Gopher still works:
+	out := testRawRequest(t, addr, "/readme.txt\r\n")
+	if out != "line\r\nmore\r\n.\r\n" {
+		t.Fatalf("%q", out)
+	}
+
+	rs, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+	body, _ := ioutil.ReadAll(rs.Body)
+	if rs.StatusCode != 200 || rs.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatal(rs.StatusCode, rs.Header)
+	}
+
+	html := string(body)
+	for _, expected := range []string{
+		"Hello &lt;world&gt;\n",
+		`<a href="/0/readme.txt">Read me</a>`,
+		`<a href="/1/sub%20dir/">Sub</a>`,
+		`<a href="gopher://example.com/1/x">Elsewhere</a>`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Fatalf("%q not found in %q", expected, html)
+		}
+	}
+
+	rs, err = http.Get("http://" + addr + "/0/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+	body, _ = ioutil.ReadAll(rs.Body)
+	if string(body) != "line\nmore\n" {
+		t.Fatalf("%q", body)
+	}
+
+	rs, err = http.Get("http://" + addr + "/0/nope.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != 404 {
+		t.Fatal(rs.StatusCode)
+	}
+}
+
+func TestHTMLGatewayTooLarge(t *testing.T) {
+	gw := &HTMLGateway{
+		Handler:         testGatewayMux(),
+		Hostname:        "localhost",
+		Port:            "70",
+		MaxResponseSize: 10,
+	}
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatal(rec.Code, rec.Body.String())
+	}
+}
+
+func TestHTMLGatewaySearchForm(t *testing.T) {
+	var search string
+	gw := &HTMLGateway{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			search = r.URL().Search
+			NewDirWriter(w, r).MustFlush()
+		}),
+	}
+
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest("GET", "/7/find", nil))
+	if !strings.Contains(rec.Body.String(), `<input name="q">`) || search != "" {
+		t.Fatal(rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest("GET", "/7/find?q=foo+bar", nil))
+	if rec.Code != 200 || search != "foo bar" {
+		t.Fatal(rec.Code, search)
+	}
+}
+
+func TestHTMLGatewayURLLinks(t *testing.T) {
+	gw := &HTMLGateway{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			io.WriteString(w, ""+
+				"hWeb\tURL:https://example.com/\tlocalhost\t70\r\n"+
+				"hXSS\tURL:javascript:alert(document.cookie)\tlocalhost\t70\r\n"+
+				"hData\tURL:data:text/html,<script>\tlocalhost\t70\r\n"+
+				"hRelative\tURL:/foo\tlocalhost\t70\r\n"+
+				".\r\n")
+		}),
+		Hostname: "localhost",
+		Port:     "70",
+	}
+
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	out := rec.Body.String()
+	if !strings.Contains(out, `<a href="https://example.com/">Web</a>`) {
+		t.Fatal(out)
+	}
+	for _, expected := range []string{"\nXSS\n", "\nData\n", "\nRelative\n"} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("%q not found in %q", expected, out)
+		}
+	}
+	if strings.Contains(out, "javascript:") || strings.Contains(out, "data:") {
+		t.Fatal(out)
+	}
+}
+
+func TestHTMLGatewayRemoteAddr(t *testing.T) {
+	var rq *Request
+	gw := &HTMLGateway{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			rq = r
+			NewDirWriter(w, r).MustFlush()
+		}),
+	}
+
+	hrq := httptest.NewRequest("GET", "/", nil)
+	hrq.RemoteAddr = "192.0.2.1:1234"
+	hrq.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+	gw.ServeHTTP(httptest.NewRecorder(), hrq)
+	if rq.RemoteAddr == nil || rq.RemoteAddr.String() != "192.0.2.1:1234" {
+		t.Fatal(rq.RemoteAddr)
+	}
+	if rq.TLS != hrq.TLS {
+		t.Fatal(rq.TLS)
+	}
+
+	hrq.RemoteAddr = "@"
+	gw.ServeHTTP(httptest.NewRecorder(), hrq)
+	if rq.RemoteAddr != nil {
+		t.Fatal(rq.RemoteAddr)
+	}
+}
+
+func TestServerHTTPSniffAccessControl(t *testing.T) {
+	loopback, _ := ParseCIDRs("127.0.0.0/8", "::1")
+	h, err := AccessControl(testGatewayMux(), AccessRule{Pattern: "/readme.txt", Deny: loopback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Handler: h, HTTPHandler: &HTMLGateway{Handler: h}}
+	addr := testServe(t, srv)
+
+	rs, err := http.Get("http://" + addr + "/0/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusForbidden {
+		t.Fatal(rs.StatusCode)
+	}
+}
+
+func TestServerHTTPSniffNoKeepAlive(t *testing.T) {
+	mux := testGatewayMux()
+	srv := &Server{Handler: mux, HTTPHandler: &HTMLGateway{Handler: mux}}
+	addr := testServe(t, srv)
+
+	out := testRawRequest(t, addr, "GET / HTTP/1.1\r\nHost: x\r\n\r\nGET /0/readme.txt HTTP/1.1\r\nHost: x\r\n\r\n")
+	if !strings.Contains(out, "Connection: close\r\n") {
+		t.Fatalf("%q", out)
+	}
+	if n := strings.Count(out, "HTTP/1.1 200"); n != 1 {
+		t.Fatal(n, out)
+	}
+}
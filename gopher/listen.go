@@ -0,0 +1,135 @@
+package gopher
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// First file descriptor passed by systemd, as per sd_listen_fds(3):
+const systemdListenFDsStart = 3
+
+// SystemdListeners returns the listeners passed to the process by systemd socket
+// activation, in the order the sockets are listed in the socket unit. If the process
+// was not socket activated, SystemdListeners returns nil and no error.
+//
+// The LISTEN_* environment variables are unset so that child processes don't also try
+// to use the sockets.
+//
+// Listeners that are not TCP (i.e. ListenStream=/run/gopher.sock) need a host passed to
+// Server.Serve().
+func SystemdListeners() ([]net.Listener, error) {
+	return systemdListeners(systemdListenFDsStart)
+}
+
+func systemdListeners(start int) ([]net.Listener, error) {
+	pidStr, fdsStr, namesStr := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	if pidStr == "" {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return nil, fmt.Errorf("gopher: systemd LISTEN_PID %q invalid", pidStr)
+	}
+	if pid != os.Getpid() {
+		// The sockets were meant for someone else:
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(fdsStr)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("gopher: systemd LISTEN_FDS %q invalid", fdsStr)
+	}
+
+	var names []string
+	if namesStr != "" {
+		names = strings.Split(namesStr, ":")
+	}
+
+	var lns = make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		fd := start + i
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		// FileListener dups the descriptor, so we close the original:
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("gopher: systemd socket %d (%s) failed: %w", fd, name, err)
+		}
+		lns = append(lns, ln)
+	}
+
+	return lns, nil
+}
+
+// InetdConn returns the connection passed to the process on stdin and stdout by inetd
+// or xinetd, for use with Server.ServeConn().
+//
+// If stdin is a socket, the returned connection has the client's RemoteAddr. If not
+// (i.e. xinetd with a pipe, or when testing from the shell), the connection reads
+// from stdin and writes to stdout and the RemoteAddr is not known.
+func InetdConn() (net.Conn, error) {
+	if conn, err := net.FileConn(os.Stdin); err == nil {
+		return conn, nil
+	}
+	return &stdioConn{r: os.Stdin, w: os.Stdout}, nil
+}
+
+type stdioAddr struct{}
+
+func (stdioAddr) Network() string { return "stdio" }
+func (stdioAddr) String() string  { return "stdio" }
+
+// stdioConn adapts a pair of files to a net.Conn. Deadlines only work if the files
+// support them (i.e. pipes); errors setting deadlines are ignored, as they are by the
+// Server.
+type stdioConn struct {
+	r, w *os.File
+}
+
+var _ net.Conn = &stdioConn{}
+
+func (sc *stdioConn) Read(b []byte) (int, error)  { return sc.r.Read(b) }
+func (sc *stdioConn) Write(b []byte) (int, error) { return sc.w.Write(b) }
+func (sc *stdioConn) LocalAddr() net.Addr         { return stdioAddr{} }
+func (sc *stdioConn) RemoteAddr() net.Addr        { return stdioAddr{} }
+
+func (sc *stdioConn) Close() error {
+	rerr := sc.r.Close()
+	werr := sc.w.Close()
+	if rerr != nil {
+		return rerr
+	}
+	return werr
+}
+
+func (sc *stdioConn) SetDeadline(t time.Time) error {
+	sc.r.SetReadDeadline(t)
+	sc.w.SetWriteDeadline(t)
+	return nil
+}
+
+func (sc *stdioConn) SetReadDeadline(t time.Time) error {
+	sc.r.SetReadDeadline(t)
+	return nil
+}
+
+func (sc *stdioConn) SetWriteDeadline(t time.Time) error {
+	sc.w.SetWriteDeadline(t)
+	return nil
+}
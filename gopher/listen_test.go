@@ -0,0 +1,119 @@
+package gopher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var remoteAddrHandler = HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+	if r.RemoteAddr == nil {
+		fmt.Fprintf(w, "%s nil", r.URL().Hostname)
+	} else {
+		fmt.Fprintf(w, "%s %s", r.URL().Hostname, r.RemoteAddr.IP)
+	}
+})
+
+func TestServerUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gopher.sock")
+
+	srv := &Server{Handler: remoteAddrHandler, ErrorLog: nilLogger}
+	if err := srv.ListenAndServeUnix(path, ""); err != errHostRequired {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Serve(ln, ""); err != errHostRequired {
+		t.Fatal(err)
+	}
+
+	go srv.Serve(ln, "gopher.example.com")
+	defer srv.Close()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("/\r\n"))
+	out, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "gopher.example.com nil" {
+		t.Fatalf("%q", out)
+	}
+}
+
+func TestServeConnPipe(t *testing.T) {
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outR.Close()
+
+	srv := &Server{Handler: remoteAddrHandler, ErrorLog: nilLogger}
+	conn := &stdioConn{r: inR, w: outW}
+	if err := srv.ServeConn(conn, ""); err != errHostRequired {
+		t.Fatal(err)
+	}
+
+	inW.Write([]byte("/\r\n"))
+	inW.Close()
+	if err := srv.ServeConn(conn, "example.com:7070"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadAll(outR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "example.com nil" {
+		t.Fatalf("%q", out)
+	}
+}
+
+func TestServeConnTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	srv := &Server{Handler: remoteAddrHandler, ErrorLog: nilLogger}
+	var result = make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			result <- err
+			return
+		}
+		result <- srv.ServeConn(conn, "")
+	}()
+
+	out := testRawRequest(t, ln.Addr().String(), "/\r\n")
+	if out != "127.0.0.1 127.0.0.1" {
+		t.Fatalf("%q", out)
+	}
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+//+build !windows
+
+package gopher
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestSystemdListeners(t *testing.T) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	// Not socket activated:
+	os.Unsetenv("LISTEN_PID")
+	lns, err := SystemdListeners()
+	if err != nil || lns != nil {
+		t.Fatal(lns, err)
+	}
+
+	// Meant for another process:
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	lns, err = SystemdListeners()
+	if err != nil || lns != nil {
+		t.Fatal(lns, err)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Fatal("env not unset")
+	}
+
+	// We can't rely on being able to put something at fd 3, so we pretend the fds start
+	// wherever our listener's file ended up:
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// systemdListeners closes the fd it is given, so it gets a copy:
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	lns, err = systemdListeners(fd)
+	if err != nil || len(lns) != 1 {
+		t.Fatal(lns, err)
+	}
+	defer lns[0].Close()
+	if lns[0].Addr().String() != ln.Addr().String() {
+		t.Fatal(lns[0].Addr())
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
 )
 
@@ -66,6 +65,7 @@ func WriteMeta(mw MetaWriter, i ItemType, disp, sel string, meta []MetaEntry) er
 }
 
 type metaWriter struct {
+	w          io.Writer
 	bufw       *bufio.Writer
 	rq         *Request
 	began      bool
@@ -78,6 +78,13 @@ type metaWriter struct {
 
 var _ MetaWriter = &metaWriter{}
 
+// NewMetaWriter returns a MetaWriter for a meta request, which writes to w. Server
+// creates one for every meta request, so this is only needed to call a MetaHandler
+// directly, i.e. in tests. Flush must be called when the MetaHandler returns.
+func NewMetaWriter(w io.Writer, rq *Request) MetaWriter {
+	return newMetaWriter(w, rq)
+}
+
 func newMetaWriter(w io.Writer, rq *Request) *metaWriter {
 	if !rq.url.IsMeta() {
 		// XXX: this may not be necessary but it was confounding some tests
@@ -85,7 +92,7 @@ func newMetaWriter(w io.Writer, rq *Request) *metaWriter {
 	}
 
 	bufw := bufio.NewWriter(w)
-	return &metaWriter{bufw: bufw, rq: rq}
+	return &metaWriter{w: w, bufw: bufw, rq: rq}
 }
 
 func (mw *metaWriter) nextRecord(last bool) {
@@ -202,24 +209,31 @@ func (mw *metaWriter) BeginRecord(record string) *MetaValueWriter {
 	return mw.lastRecord
 }
 
-// An example of a GopherIIbis error follows:
+// MetaError sends the error using the Server's ErrorRenderer. An example of a
+// GopherIIbis error follows:
 //	--404[CR][LF]The file requested could not be found.[CR][LF].[CR][LF]
 //
 func (mw *metaWriter) MetaError(code Status, msg string) {
-	if mw.infoSet {
+	if mw.infoSet || mw.began {
 		panic(ErrMetaInfoAlreadySent)
 	}
 	if strings.IndexByte(msg, '\n') >= 0 {
 		panic(fmt.Errorf("gopher: meta error message contained newlines"))
 	}
 
-	bufw := mw.bufw
-	bufw.WriteByte(MetaError)
-	bufw.WriteString(strconv.FormatInt(int64(code), 10))
-	bufw.Write(crlf)
+	// Metadata requests can only come from GopherIIbis or Gopher+ clients:
+	dialect := mw.rq.dialect
+	if dialect != DialectPlus {
+		dialect = DialectIIbis
+	}
 
-	bufw.WriteString(msg)
-	bufw.Write(crlf)
+	setResponseStatus(mw.w, code)
+	info := &ErrorInfo{Status: code, Message: msg, URL: mw.rq.url, Dialect: dialect}
+	mw.flushErr = mw.rq.errorRenderer().RenderError(mw.bufw, info)
+	if mw.flushErr == nil {
+		mw.flushErr = mw.bufw.Flush()
+	}
+	mw.flushed = true
 }
 
 type MetaValueWriter struct {
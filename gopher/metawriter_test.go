@@ -224,3 +224,16 @@ func TestMetaWriterValueCRLFExcludesRecords(t *testing.T) {
 		t.Fatal(fmt.Sprintf("%q", buf.String()))
 	}
 }
+
+func TestMetaWriterError(t *testing.T) {
+	var buf bytes.Buffer
+	var rq = NewRequest(mustParseURL("gopher://localhost:12345").AsMetaItem(), nil)
+	mw := newMetaWriter(&buf, rq)
+	mw.MetaError(StatusNotFound, "nope")
+	MustFlush(mw)
+
+	expected := "--404\r\nnope\r\n.\r\n"
+	if buf.String() != expected {
+		t.Fatal(fmt.Sprintf("%q", buf.String()))
+	}
+}
@@ -0,0 +1,305 @@
+package gopher
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetricsMaxPrefixes is the number of distinct selector prefixes Metrics will
+// count before lumping new ones into MetricsOtherPrefix.
+const DefaultMetricsMaxPrefixes = 100
+
+// MetricsOtherPrefix counts requests for prefixes beyond Metrics.MaxPrefixes.
+const MetricsOtherPrefix = "(other)"
+
+// Upper bounds of the latency histogram buckets. Anything slower goes into a final
+// unbounded bucket.
+var metricsLatencyBuckets = []time.Duration{
+	1 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Metrics collects statistics about a Server. Metrics must be attached to the Server as
+// both an AccessLogger and a ConnState hook:
+//
+//	m := gopher.NewMetrics()
+//	srv.AccessLog = m // Use MultiAccessLogger if you already have an AccessLog
+//	srv.ConnState = m.ConnState
+//
+// Metrics implements expvar.Var, so it can be published with expvar.Publish(), and
+// Handler, so it can serve a status page:
+//
+//	expvar.Publish("gopher", m)
+//	mux.Handle("/status", m, nil)
+//
+// The zero value is ready to use, but its uptime only starts when it is first used.
+// NewMetrics starts it straight away.
+type Metrics struct {
+	// Maximum number of distinct selector prefixes to count. If zero,
+	// DefaultMetricsMaxPrefixes is used.
+	MaxPrefixes int
+
+	mu         sync.Mutex
+	started    time.Time
+	active     int64
+	conns      int64
+	requests   int64
+	bytes      int64
+	byStatus   map[Status]int64
+	byPrefix   map[string]int64
+	latency    []int64 // One more than metricsLatencyBuckets
+	latencySum time.Duration
+}
+
+var (
+	_ AccessLogger = &Metrics{}
+	_ Handler      = &Metrics{}
+	_ expvar.Var   = &Metrics{}
+)
+
+func NewMetrics() *Metrics {
+	m := &Metrics{}
+	m.init()
+	return m
+}
+
+// init prepares a zero Metrics for use. m.mu must be held.
+func (m *Metrics) init() {
+	if m.byStatus != nil {
+		return
+	}
+	m.started = time.Now()
+	m.byStatus = make(map[Status]int64)
+	m.byPrefix = make(map[string]int64)
+	m.latency = make([]int64, len(metricsLatencyBuckets)+1)
+}
+
+// ConnState is used as the Server's ConnState hook to count connections.
+func (m *Metrics) ConnState(conn net.Conn, state ConnState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+	switch state {
+	case StateNew:
+		m.active++
+		m.conns++
+	case StateClosed, StateHijacked:
+		m.active--
+	}
+}
+
+// LogAccess is used as the Server's AccessLogger to count requests.
+func (m *Metrics) LogAccess(entry *AccessLogEntry) {
+	prefix := selectorPrefix(entry.Selector)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	m.requests++
+	m.bytes += entry.Bytes
+	m.byStatus[entry.Status]++
+
+	if _, ok := m.byPrefix[prefix]; !ok && len(m.byPrefix) >= m.maxPrefixes() {
+		prefix = MetricsOtherPrefix
+	}
+	m.byPrefix[prefix]++
+
+	idx := sort.Search(len(metricsLatencyBuckets), func(i int) bool {
+		return entry.Duration <= metricsLatencyBuckets[i]
+	})
+	m.latency[idx]++
+	m.latencySum += entry.Duration
+}
+
+func (m *Metrics) maxPrefixes() int {
+	if m.MaxPrefixes > 0 {
+		return m.MaxPrefixes
+	}
+	return DefaultMetricsMaxPrefixes
+}
+
+// MetricsSnapshot is a copy of the statistics collected by Metrics at a point in time.
+type MetricsSnapshot struct {
+	Uptime            time.Duration
+	ActiveConnections int64
+	Connections       int64
+	Requests          int64
+	Bytes             int64
+	ByStatus          map[Status]int64
+	ByPrefix          map[string]int64
+	Latency           []MetricsBucket // Cumulative, as in a Prometheus histogram
+	LatencySum        time.Duration
+}
+
+type MetricsBucket struct {
+	UpperBound time.Duration // Zero for the final, unbounded bucket
+	Count      int64
+}
+
+func (m *Metrics) Snapshot() *MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	snap := &MetricsSnapshot{
+		Uptime:            time.Since(m.started),
+		ActiveConnections: m.active,
+		Connections:       m.conns,
+		Requests:          m.requests,
+		Bytes:             m.bytes,
+		ByStatus:          make(map[Status]int64, len(m.byStatus)),
+		ByPrefix:          make(map[string]int64, len(m.byPrefix)),
+		Latency:           make([]MetricsBucket, len(m.latency)),
+		LatencySum:        m.latencySum,
+	}
+	for k, v := range m.byStatus {
+		snap.ByStatus[k] = v
+	}
+	for k, v := range m.byPrefix {
+		snap.ByPrefix[k] = v
+	}
+
+	var cum int64
+	for i, n := range m.latency {
+		cum += n
+		snap.Latency[i].Count = cum
+		if i < len(metricsLatencyBuckets) {
+			snap.Latency[i].UpperBound = metricsLatencyBuckets[i]
+		}
+	}
+	return snap
+}
+
+// String returns the current snapshot as JSON, which implements expvar.Var.
+func (m *Metrics) String() string {
+	snap := m.Snapshot()
+
+	type jsonBucket struct {
+		LE    interface{} `json:"le"` // Seconds, or "+Inf"
+		Count int64       `json:"count"`
+	}
+	var out = struct {
+		Uptime            float64          `json:"uptime"`
+		ActiveConnections int64            `json:"active_connections"`
+		Connections       int64            `json:"connections"`
+		Requests          int64            `json:"requests"`
+		Bytes             int64            `json:"bytes"`
+		ByStatus          map[string]int64 `json:"status"`
+		ByPrefix          map[string]int64 `json:"prefix"`
+		Latency           []jsonBucket     `json:"latency"`
+		LatencySum        float64          `json:"latency_sum"`
+	}{
+		Uptime:            snap.Uptime.Seconds(),
+		ActiveConnections: snap.ActiveConnections,
+		Connections:       snap.Connections,
+		Requests:          snap.Requests,
+		Bytes:             snap.Bytes,
+		ByStatus:          make(map[string]int64, len(snap.ByStatus)),
+		ByPrefix:          snap.ByPrefix,
+		LatencySum:        snap.LatencySum.Seconds(),
+	}
+	for status, n := range snap.ByStatus {
+		out.ByStatus[fmt.Sprintf("%d", status)] = n
+	}
+	for _, b := range snap.Latency {
+		var le interface{} = "+Inf"
+		if b.UpperBound != 0 {
+			le = b.UpperBound.Seconds()
+		}
+		out.Latency = append(out.Latency, jsonBucket{LE: le, Count: b.Count})
+	}
+
+	bts, err := json.Marshal(&out)
+	if err != nil {
+		// Should not be possible; everything in here is marshalable:
+		panic(err)
+	}
+	return string(bts)
+}
+
+// ServeGopher renders the current snapshot as a status page.
+func (m *Metrics) ServeGopher(ctx context.Context, w ResponseWriter, r *Request) {
+	snap := m.Snapshot()
+	dw := NewDirWriter(w, r)
+
+	dw.Info(fmt.Sprintf("Uptime: %s", snap.Uptime.Truncate(time.Second)))
+	dw.Info(fmt.Sprintf("Connections: %d active, %d total", snap.ActiveConnections, snap.Connections))
+	dw.Info(fmt.Sprintf("Requests: %d, %d bytes sent", snap.Requests, snap.Bytes))
+
+	dw.Info("")
+	dw.Info("Requests by status:")
+	var statuses = make([]Status, 0, len(snap.ByStatus))
+	for status := range snap.ByStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i] < statuses[j] })
+	for _, status := range statuses {
+		dw.Info(fmt.Sprintf("  %3d: %d", status, snap.ByStatus[status]))
+	}
+
+	dw.Info("")
+	dw.Info("Requests by selector prefix:")
+	var prefixes = make([]string, 0, len(snap.ByPrefix))
+	for prefix := range snap.ByPrefix {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		ci, cj := snap.ByPrefix[prefixes[i]], snap.ByPrefix[prefixes[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		return prefixes[i] < prefixes[j]
+	})
+	for _, prefix := range prefixes {
+		dw.Info(fmt.Sprintf("  %s: %d", prefix, snap.ByPrefix[prefix]))
+	}
+
+	dw.Info("")
+	dw.Info("Latency:")
+	for _, b := range snap.Latency {
+		if b.UpperBound == 0 {
+			dw.Info(fmt.Sprintf("  all: %d", b.Count))
+		} else {
+			dw.Info(fmt.Sprintf("  <= %s: %d", b.UpperBound, b.Count))
+		}
+	}
+
+	dw.MustFlush()
+}
+
+// selectorPrefix returns the first path segment of a selector, i.e. '/docs/foo.txt'
+// becomes '/docs'.
+func selectorPrefix(sel string) string {
+	sel = strings.TrimLeft(sel, "/")
+	if idx := strings.IndexByte(sel, '/'); idx >= 0 {
+		sel = sel[:idx]
+	}
+	return "/" + sel
+}
+
+// MultiAccessLogger passes every entry to each of the loggers in turn.
+func MultiAccessLogger(loggers ...AccessLogger) AccessLogger {
+	return AccessLoggerFunc(func(entry *AccessLogEntry) {
+		for _, l := range loggers {
+			l.LogAccess(entry)
+		}
+	})
+}
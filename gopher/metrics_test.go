@@ -0,0 +1,123 @@
+package gopher
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServerConnState(t *testing.T) {
+	var mu sync.Mutex
+	var states []ConnState
+	var closed = make(chan struct{}, 1)
+
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {}),
+		ConnState: func(conn net.Conn, state ConnState) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, state)
+			if state == StateClosed {
+				closed <- struct{}{}
+			}
+		},
+	}
+	addr := testServe(t, srv)
+	testRawRequest(t, addr, "/\r\n")
+	<-closed
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(states) != 3 || states[0] != StateNew || states[1] != StateActive || states[2] != StateClosed {
+		t.Fatal(states)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.MaxPrefixes = 2
+
+	mux := NewMux()
+	mux.Handle("/docs/*path", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Write([]byte("doc"))
+	}), nil)
+	mux.Handle("/status", m, nil)
+
+	srv := &Server{Handler: mux, AccessLog: m, ConnState: m.ConnState}
+	addr := testServe(t, srv)
+
+	testRawRequest(t, addr, "/docs/a.txt\r\n")
+	testRawRequest(t, addr, "/docs/b.txt\r\n")
+	testRawRequest(t, addr, "/nope.txt\r\n")
+	testRawRequest(t, addr, "/other.txt\r\n")
+
+	// The access log is written after the response, so we have to wait for it:
+	deadline := time.Now().Add(2 * time.Second)
+	for m.Snapshot().Requests < 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	snap := m.Snapshot()
+	if snap.ByStatus[OK] != 2 || snap.ByStatus[StatusNotFound] != 2 {
+		t.Fatal(snap.ByStatus)
+	}
+	if snap.ByPrefix["/docs"] != 2 || snap.ByPrefix["/nope.txt"] != 1 || snap.ByPrefix[MetricsOtherPrefix] != 1 {
+		t.Fatal(snap.ByPrefix)
+	}
+	if snap.Connections != 4 || snap.Bytes < 6 {
+		t.Fatal(snap)
+	}
+	if last := snap.Latency[len(snap.Latency)-1]; last.UpperBound != 0 || last.Count != 4 {
+		t.Fatal(snap.Latency)
+	}
+
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(m.String()), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v["requests"].(float64) != 4 {
+		t.Fatal(v)
+	}
+
+	out := testRawRequest(t, addr, "/status\r\n")
+	if !strings.Contains(out, " active, 5 total\t") ||
+		!strings.Contains(out, "i  404: 2\t") ||
+		!strings.Contains(out, "i  /docs: 2\t") {
+		t.Fatalf("%q", out)
+	}
+}
+
+func TestMetricsZero(t *testing.T) {
+	var m Metrics
+	m.LogAccess(&AccessLogEntry{Selector: "/docs/a.txt", Status: OK, Bytes: 3})
+	m.ConnState(nil, StateNew)
+
+	snap := m.Snapshot()
+	if snap.Requests != 1 || snap.ByStatus[OK] != 1 || snap.ByPrefix["/docs"] != 1 || snap.Connections != 1 {
+		t.Fatal(snap)
+	}
+	if snap.Uptime < 0 || snap.Uptime > time.Minute {
+		t.Fatal(snap.Uptime)
+	}
+}
+
+func TestSelectorPrefix(t *testing.T) {
+	for in, out := range map[string]string{
+		"":           "/",
+		"/":          "/",
+		"/foo":       "/foo",
+		"foo/bar":    "/foo",
+		"//foo/bar/": "/foo",
+	} {
+		if result := selectorPrefix(in); result != out {
+			t.Fatal(in, result)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package gopher
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrHandlerTimeout = errors.New("gopher: handler timeout")
+
+// Middleware wraps a Handler to add behaviour before and/or after it is called.
+//
+// Middleware may wrap the ResponseWriter, so Handlers must not type-assert it to reach
+// the writer the Server passed in. ServerWriter() and PlusWriter() find it through any
+// wrappers that provide an 'Unwrap() ResponseWriter' method, as all of the middleware
+// in this package do.
+type Middleware func(Handler) Handler
+
+// Chain wraps h in the middleware, with the first middleware being the outermost.
+//
+// Middleware only applies to ServeGopher. If h implements MetaHandler, the returned
+// Handler will also implement MetaHandler by passing metadata requests straight to h.
+func Chain(h Handler, mw ...Middleware) Handler {
+	wrapped := h
+	for i := len(mw) - 1; i >= 0; i-- {
+		wrapped = mw[i](wrapped)
+	}
+	if mh, ok := h.(MetaHandler); ok {
+		return &chainMetaHandler{Handler: wrapped, meta: mh}
+	}
+	return wrapped
+}
+
+type chainMetaHandler struct {
+	Handler
+	meta MetaHandler
+}
+
+func (c *chainMetaHandler) ServeGopherMeta(ctx context.Context, w MetaWriter, r *Request) {
+	c.meta.ServeGopherMeta(ctx, w, r)
+}
+
+// Recover returns a Middleware that recovers from panics in the Handler, logs them, and
+// sends a StatusInternal error to the client if nothing has been written yet. If log is
+// nil, the standard logger is used.
+func Recover(log Logger) Middleware {
+	if log == nil {
+		log = stdLogger
+	}
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			tw := &trackingWriter{w: w}
+			defer func() {
+				if err := recover(); err != nil {
+					_, file, line, _ := runtime.Caller(3)
+					log.Printf("gopher: panic serving %s at %s:%d: %v\n", r.remoteAddrString(), file, line, err)
+					if tw.n == 0 {
+						RespondError(w, r, StatusInternal, "Internal server error")
+					}
+				}
+			}()
+			h.ServeGopher(ctx, tw, r)
+		})
+	}
+}
+
+// AccessLog returns a Middleware that logs each request in CommonLogEncoder's format
+// after the Handler returns. If log is nil, the standard logger is used.
+//
+// To log every request received by a Server, including those that never make it to a
+// Handler, use Server.AccessLog instead.
+func AccessLog(log Logger) Middleware {
+	if log == nil {
+		log = stdLogger
+	}
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			start := time.Now()
+			tw := &trackingWriter{w: w}
+			h.ServeGopher(ctx, tw, r)
+
+			entry := newAccessLogEntry(start, r, tw)
+			log.Printf("gopher: %s\n", CommonLogEncoder(nil, entry))
+		})
+	}
+}
+
+// TimeoutHandler returns a Handler that runs h with the given time limit. The context
+// passed to h is cancelled when the time limit expires.
+//
+// If h has not written anything when the time limit expires, a StatusRequestTimeout
+// error is sent to the client with the given message. If h has already started writing,
+// the response is cut short. After the time limit expires, writes from h return
+// ErrHandlerTimeout.
+func TimeoutHandler(h Handler, dt time.Duration, msg string) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		ctx, cancel := context.WithTimeout(ctx, dt)
+		defer cancel()
+
+		// h may still be running after we return, by which time a Mux may have reused
+		// the Params:
+		r2 := *r
+		r2.Params = r.Params.Copy()
+
+		tw := &timeoutWriter{w: w}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			h.ServeGopher(ctx, tw, &r2)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+
+		case <-done:
+
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			if !tw.wrote {
+				RespondError(w, r, StatusRequestTimeout, msg)
+			}
+			tw.timedOut = true
+		}
+	})
+}
+
+type timeoutWriter struct {
+	w        ResponseWriter
+	mu       sync.Mutex
+	wrote    bool
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Unwrap() ResponseWriter { return tw.w }
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, ErrHandlerTimeout
+	}
+	tw.wrote = true
+	return tw.w.Write(b)
+}
+
+// StripPrefix returns a Handler that removes the prefix from the request's selector
+// and passes it to h. The prefix is appended to the Request's SelectorPrefix, so that
+// writers like DirWriter continue to build correct selectors.
+//
+// The prefix only matches whole path segments; "/foo" matches "/foo" and "/foo/bar",
+// but not "/foobar". Requests that do not match the prefix receive a StatusNotFound
+// error.
+//
+// If h implements MetaHandler, the returned Handler does too.
+func StripPrefix(prefix string, h Handler) Handler {
+	sp := &stripPrefixHandler{prefix: strings.TrimRight(prefix, "/"), h: h}
+	if mh, ok := h.(MetaHandler); ok {
+		return &stripPrefixMetaHandler{stripPrefixHandler: sp, meta: mh}
+	}
+	return sp
+}
+
+type stripPrefixHandler struct {
+	prefix string
+	h      Handler
+}
+
+func (sp *stripPrefixHandler) strip(r *Request) (*Request, bool) {
+	sel := r.url.Selector
+	if !strings.HasPrefix(sel, sp.prefix) {
+		return nil, false
+	}
+	rest := sel[len(sp.prefix):]
+	if rest != "" && rest[0] != '/' {
+		return nil, false
+	}
+
+	r2 := *r
+	r2.url.Selector = rest
+	r2.url.Root = rest == ""
+	r2.SelectorPrefix = r.SelectorPrefix + sp.prefix
+	return &r2, true
+}
+
+func (sp *stripPrefixHandler) ServeGopher(ctx context.Context, w ResponseWriter, r *Request) {
+	r2, ok := sp.strip(r)
+	if !ok {
+		NotFound(w, r)
+		return
+	}
+	sp.h.ServeGopher(ctx, w, r2)
+}
+
+type stripPrefixMetaHandler struct {
+	*stripPrefixHandler
+	meta MetaHandler
+}
+
+func (sp *stripPrefixMetaHandler) ServeGopherMeta(ctx context.Context, w MetaWriter, r *Request) {
+	r2, ok := sp.strip(r)
+	if !ok {
+		w.MetaError(StatusNotFound, "Not found: "+r.url.Selector)
+		return
+	}
+	sp.meta.ServeGopherMeta(ctx, w, r2)
+}
+
+// trackingWriter counts the bytes written through it, and records the Status of any
+// error sent with RespondError.
+type trackingWriter struct {
+	w      ResponseWriter
+	n      int64
+	status Status
+}
+
+func (tw *trackingWriter) Unwrap() ResponseWriter { return tw.w }
+
+func (tw *trackingWriter) Write(b []byte) (int, error) {
+	n, err := tw.w.Write(b)
+	tw.n += int64(n)
+	return n, err
+}
+
+// setResponseStatus records the status in every trackingWriter wrapped by w, down to
+// the ServerResponseWriter, which records it in its own.
+func setResponseStatus(w interface{}, status Status) {
+	unwrapResponseWriter(w, func(w interface{}) bool {
+		switch w := w.(type) {
+		case *trackingWriter:
+			w.status = status
+		case ServerResponseWriter:
+			w.SetStatus(status)
+			return true
+		}
+		return false
+	})
+}
+
+// unwrapResponseWriter walks down through any ResponseWriters wrapped by middleware,
+// calling fn on each, until fn returns true.
+func unwrapResponseWriter(w interface{}, fn func(w interface{}) bool) {
+	for w != nil {
+		if fn(w) {
+			return
+		}
+		uw, ok := w.(interface{ Unwrap() ResponseWriter })
+		if !ok {
+			return
+		}
+		w = uw.Unwrap()
+	}
+}
@@ -0,0 +1,224 @@
+package gopher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (rl *recordLogger) Printf(format string, v ...interface{}) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.lines = append(rl.lines, fmt.Sprintf(format, v...))
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+				order = append(order, name)
+				h.ServeGopher(ctx, w, r)
+			})
+		}
+	}
+	h := Chain(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		order = append(order, "h")
+	}), mw("a"), mw("b"))
+
+	h.ServeGopher(context.Background(), &strings.Builder{}, NewRequest(URL{}, nil))
+	if strings.Join(order, ",") != "a,b,h" {
+		t.Fatal(order)
+	}
+}
+
+func TestChainPreservesMetaHandler(t *testing.T) {
+	h := Chain(NewMux(), Recover(nilLogger))
+	if _, ok := h.(MetaHandler); !ok {
+		t.Fatal()
+	}
+	h = Chain(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {}), Recover(nilLogger))
+	if _, ok := h.(MetaHandler); ok {
+		t.Fatal()
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var rl recordLogger
+	mux := NewMux()
+	mux.Handle("panic.txt", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		panic("boom")
+	}), nil)
+	mux.Handle("late.txt", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}), nil)
+
+	addr := testServe(t, &Server{Handler: Chain(mux, Recover(&rl))})
+
+	out := testRawRequest(t, addr, "/panic.txt\r\n")
+	if out != "Error: 500, Internal server error\r\n.\r\n" {
+		t.Fatalf("%q", out)
+	}
+
+	out = testRawRequest(t, addr, "/late.txt\r\n")
+	if out != "partial" {
+		t.Fatalf("%q", out)
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if len(rl.lines) != 2 || !strings.Contains(rl.lines[0], "boom") {
+		t.Fatal(rl.lines)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var rl recordLogger
+	h := Chain(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Write([]byte("hello"))
+	}), AccessLog(&rl))
+
+	rq := NewRequest(URL{Selector: "/foo", Search: "bar"}, nil)
+	h.ServeGopher(context.Background(), &strings.Builder{}, rq)
+	if len(rl.lines) != 1 || !strings.Contains(rl.lines[0], `"/foo" "bar" 0 5 gopher - `) {
+		t.Fatal(rl.lines)
+	}
+}
+
+func TestMiddlewareUnwrap(t *testing.T) {
+	h := Chain(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		if _, ok := w.(*PlusResponseWriter); ok {
+			t.Error("middleware did not wrap the ResponseWriter")
+		}
+		if ServerWriter(w) == nil {
+			t.Error("ServerWriter not found")
+		}
+		if pw := PlusWriter(w); (pw != nil) != (r.Dialect() == DialectPlus) {
+			t.Error("PlusWriter not found")
+		} else if pw != nil {
+			if err := pw.SetSize(3); err != nil {
+				t.Error(err)
+			}
+		}
+		w.Write([]byte("bin"))
+	}), Recover(nilLogger), AccessLog(nilLogger))
+
+	addr := testServe(t, &Server{Handler: h})
+	out := testRawRequest(t, addr, "/bin\t+\r\n")
+	if out != "+3\r\nbin" {
+		t.Fatalf("%q", out)
+	}
+
+	out = testRawRequest(t, addr, "/bin\r\n")
+	if out != "bin" {
+		t.Fatalf("%q", out)
+	}
+}
+
+func TestTimeoutHandler(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	var writeErr = make(chan error, 1)
+
+	mux := NewMux()
+	mux.Handle("slow.txt", TimeoutHandler(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		<-ctx.Done()
+		<-release
+		_, err := w.Write([]byte("too late"))
+		writeErr <- err
+	}), 10*time.Millisecond, "Too slow"), nil)
+
+	mux.Handle("fast.txt", TimeoutHandler(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Write([]byte("quick"))
+	}), time.Second, "Too slow"), nil)
+
+	addr := testServe(t, &Server{Handler: mux})
+
+	out := testRawRequest(t, addr, "/slow.txt\r\n")
+	if out != "Error: 408, Too slow\r\n.\r\n" {
+		t.Fatalf("%q", out)
+	}
+	release <- struct{}{}
+	if err := <-writeErr; err != ErrHandlerTimeout {
+		t.Fatal(err)
+	}
+
+	out = testRawRequest(t, addr, "/fast.txt\r\n")
+	if out != "quick" {
+		t.Fatalf("%q", out)
+	}
+}
+
+func TestTimeoutHandlerPlus(t *testing.T) {
+	h := TimeoutHandler(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		<-ctx.Done()
+	}), time.Millisecond, "Too slow")
+
+	addr := testServe(t, &Server{Handler: h})
+	out := testRawRequest(t, addr, "/slow.txt\t+\r\n")
+	if out != "--1\r\n2 Error: 408, Too slow\r\n.\r\n" {
+		t.Fatalf("%q", out)
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	var sel, prefix string
+	inner := HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		sel, prefix = r.url.Selector, r.SelectorPrefix
+	})
+
+	for idx, tc := range []struct {
+		strip, in   string
+		sel, prefix string
+		ok          bool
+	}{
+		{"/foo", "/foo/bar", "/bar", "/base/foo", true},
+		{"/foo/", "/foo/bar", "/bar", "/base/foo", true},
+		{"/foo", "/foo", "", "/base/foo", true},
+		{"/foo", "/foobar", "", "", false},
+		{"/foo", "/bar", "", "", false},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			sel, prefix = "", ""
+			var out strings.Builder
+			rq := NewRequest(URL{Selector: tc.in}, nil)
+			rq.SelectorPrefix = "/base"
+			StripPrefix(tc.strip, inner).ServeGopher(context.Background(), &out, rq)
+
+			if tc.ok {
+				if sel != tc.sel || prefix != tc.prefix || out.Len() != 0 {
+					t.Fatal(sel, prefix, out.String())
+				}
+				if rq.url.Selector != tc.in || rq.SelectorPrefix != "/base" {
+					t.Fatal("original request modified")
+				}
+			} else if !strings.HasPrefix(out.String(), "3Error: 404") {
+				t.Fatal(out.String())
+			}
+		})
+	}
+}
+
+func TestStripPrefixDirWriter(t *testing.T) {
+	mux := NewMux()
+	mux.Handle("/", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		dw := NewDirWriter(w, r)
+		dw.Dir("Child", "/child")
+		dw.MustFlush()
+	}), nil)
+	addr := testServe(t, &Server{Handler: StripPrefix("/sub", mux)})
+	out := testRawRequest(t, addr, "/sub\r\n")
+	if !strings.Contains(out, "\t/sub/child\t") {
+		t.Fatalf("%q", out)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Mux is the 2-hour version of httprouter. Maybe I'll come back and add the 1-week
@@ -21,6 +25,23 @@ import (
 //  /user/gordon/profile      no match
 //  /user/                    no match
 //
+// Param Constraints
+//
+// Named parameters may be followed by a constraint in braces, which the segment must
+// satisfy to match. The constraint is one of 'int', 'uint' or 'date' (YYYY-MM-DD, see
+// ParamDateLayout), or a regular expression, which must match the whole segment:
+//
+// Patterns: /post/:id{int}, /post/:slug{[a-z0-9-]+}, /post/:other
+//
+//  Selector                  Handler
+//  /post/123                 /post/:id{int}
+//  /post/hello-world         /post/:slug{[a-z0-9-]+}
+//  /post/Hello               /post/:other
+//
+// If the segment does not satisfy a constraint, the next candidate is tried instead.
+// Constrained parameters are tried in the order they were added, then the
+// unconstrained parameter or catch-all, if there is one.
+//
 // Catch-All parameters
 //
 // Catch-all parameters and have the form *name, and match everything to the end
@@ -54,8 +75,11 @@ import (
 //	/foo/stuff    /foo/*rest
 //
 type Mux struct {
-	root      muxNode
-	maxParams int
+	root        muxNode
+	maxParams   int
+	params      sync.Pool
+	named       map[string][]muxSegment
+	constraints map[string]*muxConstraint
 
 	CatchAllRequiresTrailingSlash bool
 }
@@ -65,83 +89,147 @@ func NewMux() *Mux {
 	return m
 }
 
-func (mux *Mux) addParam(params Params, p Param) Params {
+func (mux *Mux) addParam(params *Params, p Param) *Params {
+	if params == nil {
+		if v := mux.params.Get(); v != nil {
+			params = v.(*Params)
+		} else {
+			ps := make(Params, 0, mux.maxParams)
+			params = &ps
+		}
+	}
+	*params = append(*params, p)
+	return params
+}
+
+// putParams returns params from findNode to the pool once the handler is done with them.
+func (mux *Mux) putParams(params *Params) {
+	if params != nil {
+		*params = (*params)[:0]
+		mux.params.Put(params)
+	}
+}
+
+func paramsLen(params *Params) int {
 	if params == nil {
-		params = make(Params, 0, mux.maxParams)
+		return 0
 	}
-	return append(params, p)
+	return len(*params)
 }
 
-func (mux *Mux) findNode(path string) (*muxNode, Params) {
+// findNode finds the node for path. The position in the tree is tracked as a node and
+// an offset into its path, as a segment may end part way along a compressed edge.
+// The Params must be passed to putParams when the caller is done with them.
+func (mux *Mux) findNode(path string) (*muxNode, *Params) {
 	orig := path
 	path = trimSlash(path)
 	hasTrailingSlash := len(path) > 0 && orig[len(orig)-1] == '/'
 
-	start := 0
-
-	var params Params
+	var params *Params
 	var lastWild *muxNode
 	var lastWildStart, lastWildParam int
 
-	cur := &mux.root
-	for i := 0; i <= len(path); i++ {
-		if i == len(path) || path[i] == '/' {
-			if start == i {
-				start++
-				continue // Skip empty segments
+	cur, off := &mux.root, 0
+	for i := 0; i < len(path); {
+		if i > 0 {
+			for i < len(path) && path[i] == '/' {
+				i++ // Skip empty segments
 			}
-
-			// If see a catch-all, grab hold of it as it's what we should fall back to if
-			// the match fails from here.
-			if cur.childWild != nil && cur.childWild.kind == muxNodeCatchAll {
-				lastWild, lastWildStart, lastWildParam = cur.childWild, start, len(params)
+			if cur, off = cur.step(off, '/'); cur == nil {
+				break
 			}
+		}
 
-			// Fixed paths take precedence:
-			if cur.childPaths != nil {
-				next, ok := cur.childPaths[path[start:i]]
-				if ok {
-					cur = next
-					start = i + 1
-					continue
-				}
-			}
+		start := i
+		for i < len(path) && path[i] != '/' {
+			i++
+		}
+		seg := path[start:i]
 
-			// Now check if we have a param match (skipping over catch-all matches, which
-			// we deal with at the end):
-			if cur.childWild != nil {
-				cur = cur.childWild
-				if cur.kind == muxNodeParam {
-					params = mux.addParam(params, Param{cur.param, path[start:i]})
-				}
-				start = i + 1
-				continue
+		// Params only hang off the end of a node, never part way along an edge:
+		var wilds *muxNode
+		if off == len(cur.path) {
+			wilds = cur
+		}
+
+		// If see a catch-all, grab hold of it as it's what we should fall back to if
+		// the match fails from here.
+		if wilds != nil && wilds.childWild != nil && wilds.childWild.kind == muxNodeCatchAll {
+			lastWild, lastWildStart, lastWildParam = wilds.childWild, start, paramsLen(params)
+		}
 
-			} else {
-				cur = nil
+		// Fixed paths take precedence:
+		if next, nextOff := cur.matchPath(off, seg); next != nil {
+			cur, off = next, nextOff
+			continue
+		}
+		if wilds == nil {
+			cur = nil
+			break
+		}
+
+		// Constrained params are tried before the unconstrained param:
+		if next := wilds.matchConstrained(seg); next != nil {
+			cur, off = next, len(next.path)
+			params = mux.addParam(params, Param{cur.param, seg})
+			continue
+		}
+
+		// Now check if we have a param match (skipping over catch-all matches, which
+		// we deal with at the end):
+		if wilds.childWild != nil {
+			cur = wilds.childWild
+			off = len(cur.path)
+			if cur.kind == muxNodeCatchAll {
 				break
 			}
+			params = mux.addParam(params, Param{cur.param, seg})
+			continue
+
+		} else {
+			cur = nil
+			break
 		}
 	}
 
-	if cur != nil &&
-		cur.handler == nil &&
-		cur.meta == nil &&
-		cur.childWild != nil &&
-		cur.childWild.kind == muxNodeCatchAll &&
-		(!mux.CatchAllRequiresTrailingSlash || hasTrailingSlash || path == "") {
+	if cur != nil && cur.kind != muxNodeCatchAll {
+		var wilds *muxNode
+		if cur == &mux.root {
+			wilds = cur
+		} else {
+			wilds = cur.after(off)
+		}
+
+		if off == len(cur.path) && cur.HasAnyHandler() {
+			return cur, params
+		}
+
+		if wilds != nil &&
+			wilds.childWild != nil &&
+			wilds.childWild.kind == muxNodeCatchAll &&
+			(!mux.CatchAllRequiresTrailingSlash || hasTrailingSlash || path == "") {
 
-		// This covers the situation where the found node has no handler, but it has
-		// a catch-all as a child.
+			// This covers the situation where the found node has no handler, but it has
+			// a catch-all as a child.
+			cur = wilds.childWild
+			params = mux.addParam(params, Param{cur.param, ""})
 
-		cur = cur.childWild
-		params = mux.addParam(params, Param{cur.param, ""})
+		} else if off < len(cur.path) {
+			// The path ends on a segment part way along an edge, which has no handler:
+			cur = &muxNodeEmpty
+		}
 
-	} else if (cur == nil || cur.kind == muxNodeCatchAll) && lastWild != nil {
+	} else if lastWild != nil {
 		// This covers if we see the catch-all last, or if we see a catch-all at some
 		// point during our traversal but the more specific match fails:
 		cur = lastWild
-		params = mux.addParam(params[:lastWildParam], Param{cur.param, path[lastWildStart:]})
+		if params != nil {
+			*params = (*params)[:lastWildParam]
+		}
+		params = mux.addParam(params, Param{cur.param, path[lastWildStart:]})
+
+	} else {
+		cur = nil
 	}
 
 	return cur, params
@@ -155,7 +243,11 @@ func (mux *Mux) findNode(path string) (*muxNode, Params) {
 //
 // If meta is nil but handler implements MetaHandler, it will be used as the MetaHandler.
 //
-func (mux *Mux) Handle(pattern string, handler Handler, meta MetaHandler) {
+// If any RouteOptions are passed, the handlers are only used for requests that satisfy
+// them. A pattern may be handled any number of times with RouteOptions; each is tried
+// in the order it was added, then the handlers added without RouteOptions, if any.
+//
+func (mux *Mux) Handle(pattern string, handler Handler, meta MetaHandler, opts ...RouteOption) {
 	if meta == nil {
 		hmeta, ok := handler.(MetaHandler)
 		if ok {
@@ -163,95 +255,255 @@ func (mux *Mux) Handle(pattern string, handler Handler, meta MetaHandler) {
 		}
 	}
 
-	parent := &mux.root
+	route := &muxRoute{handler: handler, meta: meta}
+	for _, opt := range opts {
+		opt(route)
+	}
 
-	pattern = trimSlash(pattern)
-	if pattern == "" {
-		if parent.HasChildren() {
+	var parts []string
+	for _, part := range splitMuxPattern(trimSlash(pattern)) {
+		if len(part) > 0 {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) == 0 {
+		if mux.root.HasChildren() {
 			panic(fmt.Errorf("gopher: root handler already exists"))
 		}
-		parent.handler, parent.meta = handler, meta
+		mux.root.pattern = "/"
+		mux.root.set(route)
 		return
 	}
 
-	parts := strings.Split(pattern, "/")
-	last := ""
 	path, last := parts[:len(parts)-1], parts[len(parts)-1]
 
 	params := 0
 
-	for _, part := range path {
-		if len(part) == 0 {
-			continue
+	cur, off := &mux.root, 0
+	for i, part := range path {
+		if i > 0 {
+			cur, off = cur.insertPath(off, "/")
 		}
+
 		switch part[0] {
 		case '*':
 			panic(errors.New("gopher: mux catch-all must be last"))
 
 		case ':':
-			if parent.childWild != nil && parent.childWild.part != part {
+			parent := cur.splitAt(off)
+			if isConstrainedParam(part) {
+				cur = mux.constrainedChild(parent, part)
+				off = len(cur.path)
+				params++
+				break
+			}
+
+			if parent.childWild != nil && parent.childWild.path != part {
 				panic(fmt.Errorf("gopher: param %q conflicts with existing param %q for pattern %q", part, parent.childWild.param, pattern))
 			}
 
 			if parent.childWild == nil {
-				cur := &muxNode{parent: parent, part: part, kind: muxNodeParam, param: part[1:]}
-				parent.childWild = cur
+				parent.childWild = &muxNode{path: part, kind: muxNodeParam, param: part[1:]}
 			}
 
-			parent = parent.childWild
+			cur = parent.childWild
+			off = len(cur.path)
 			params++
 
 		default:
-			children := parent.ChildPaths()
-
-			cur, ok := children[part]
-			if !ok {
-				cur = &muxNode{parent: parent, part: part, kind: muxNodePath}
-				children[part] = cur
-			}
-			parent = cur
+			cur, off = cur.insertPath(off, part)
 		}
 	}
 
+	if len(path) > 0 {
+		cur, off = cur.insertPath(off, "/")
+	}
+
 	switch last[0] {
 	case '*', ':':
+		parent := cur.splitAt(off)
+		if last[0] == ':' && isConstrainedParam(last) {
+			cur = mux.constrainedChild(parent, last)
+			params++
+			break
+		}
+
 		kind := muxNodeParam
 		if last[0] == '*' {
 			kind = muxNodeCatchAll
 		}
-		if parent.childWild != nil {
-			child := parent.childWild
-			if child.HasAnyHandler() {
-				panic(fmt.Errorf("gopher: param node %q already has handler for pattern %q", last, pattern))
-			}
-			child.handler, child.meta = handler, meta
-
-		} else {
-			parent.childWild = &muxNode{
-				parent: parent, part: last, param: last[1:], kind: kind,
-				handler: handler, meta: meta,
-			}
+		if parent.childWild == nil {
+			parent.childWild = &muxNode{path: last, param: last[1:], kind: kind}
 		}
+		cur = parent.childWild
 		params++
 
 	default:
-		children := parent.ChildPaths()
-		child := children[last]
-		if child != nil {
-			if child.HasAnyHandler() {
-				panic(fmt.Errorf("gopher: mux path %q already exists", pattern))
+		cur, off = cur.insertPath(off, last)
+		cur = cur.splitAt(off)
+	}
+
+	// If the node already exists, but doesn't have a handler, it's safe to set.
+	if !cur.set(route) {
+		if last[0] == '*' || last[0] == ':' {
+			panic(fmt.Errorf("gopher: param node %q already has handler for pattern %q", last, pattern))
+		}
+		panic(fmt.Errorf("gopher: mux path %q already exists", pattern))
+	}
+	cur.pattern = "/" + strings.Join(parts, "/")
+
+	mux.updateParamsCap(params)
+}
+
+// HandleNamed is the same as Handle, but also names the pattern so selectors for it
+// can be built with Selector().
+//
+// Calling HandleNamed() twice with the same name will result in a panic.
+func (mux *Mux) HandleNamed(name, pattern string, handler Handler, meta MetaHandler, opts ...RouteOption) {
+	if _, ok := mux.named[name]; ok {
+		panic(fmt.Errorf("gopher: mux route name %q already exists", name))
+	}
+	mux.Handle(pattern, handler, meta, append(opts[:len(opts):len(opts)], routeName(name))...)
+
+	if mux.named == nil {
+		mux.named = make(map[string][]muxSegment)
+	}
+	var segs []muxSegment
+	for _, part := range splitMuxPattern(trimSlash(pattern)) {
+		if len(part) == 0 {
+			continue
+		}
+		seg := muxSegment{part: part}
+		switch part[0] {
+		case '*':
+			seg.kind, seg.param = muxNodeCatchAll, part[1:]
+		case ':':
+			seg.kind, seg.param = muxNodeParam, part[1:]
+			if isConstrainedParam(part) {
+				seg.param, seg.constraint = mux.parseConstrainedParam(part)
 			}
-			// If the node already exists, but doesn't have a handler, it's safe to set.
-			child.kind, child.handler, child.meta = muxNodePath, handler, meta
+		}
+		segs = append(segs, seg)
+	}
+	mux.named[name] = segs
+}
+
+// Selector builds a selector for the pattern registered with HandleNamed() as name.
+// Params are pairs of param names and values, without the ':' or '*':
+//
+//	mux.HandleNamed("file", "/user/:user/files/*path", handler, nil)
+//	sel, err := mux.Selector("file", "user", "gordon", "path", "docs/readme.txt")
+//	// sel == "/user/gordon/files/docs/readme.txt"
+//
+// Every param in the pattern must be given exactly once. Values for ':' params must
+// not be empty or contain '/', and must satisfy the param's constraint if it has one.
+// No value may contain a tab, CR or LF. Anything else would build a selector that does
+// not match the pattern.
+//
+// The selector does not include the Request's SelectorPrefix; see Request.Selector()
+// and DirWriter.Route().
+func (mux *Mux) Selector(name string, params ...string) (string, error) {
+	segs, ok := mux.named[name]
+	if !ok {
+		return "", fmt.Errorf("gopher: mux route %q not found", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("gopher: mux route %q params must be name/value pairs", name)
+	}
+
+	var sb strings.Builder
+	used := 0
+	for _, seg := range segs {
+		sb.WriteByte('/')
+
+		if seg.kind == muxNodePath {
+			sb.WriteString(seg.part)
+			continue
+		}
+
+		value, ok := muxSelectorParam(params, seg.param)
+		if !ok {
+			return "", fmt.Errorf("gopher: mux route %q param %q missing", name, seg.param)
+		}
+		used++
 
+		if strings.ContainsAny(value, "\t\r\n") {
+			return "", fmt.Errorf("gopher: mux route %q param %q contains invalid characters", name, seg.param)
+		}
+		if seg.kind == muxNodeParam {
+			if value == "" || strings.IndexByte(value, '/') >= 0 {
+				return "", fmt.Errorf("gopher: mux route %q param %q must be a single, non-empty path segment", name, seg.param)
+			}
+			if seg.constraint != nil && !seg.constraint.match(value) {
+				return "", fmt.Errorf("gopher: mux route %q param %q does not satisfy {%s}", name, seg.param, seg.constraint.expr)
+			}
 		} else {
-			children[last] = &muxNode{
-				parent: parent, part: last, kind: muxNodePath,
-				handler: handler, meta: meta}
+			value = strings.TrimLeft(value, "/")
 		}
+		sb.WriteString(value)
 	}
 
-	mux.updateParamsCap(params)
+	if used*2 != len(params) {
+		return "", fmt.Errorf("gopher: mux route %q given unknown or duplicate params", name)
+	}
+	if sb.Len() == 0 {
+		return "/", nil
+	}
+	return sb.String(), nil
+}
+
+type muxSegment struct {
+	part       string
+	param      string
+	kind       byte
+	constraint *muxConstraint
+}
+
+func muxSelectorParam(params []string, name string) (value string, ok bool) {
+	for i := 0; i < len(params); i += 2 {
+		if params[i] == name {
+			return params[i+1], true
+		}
+	}
+	return "", false
+}
+
+// constrainedChild finds or creates the child of parent for a constrained param part,
+// i.e. ':id{int}'.
+func (mux *Mux) constrainedChild(parent *muxNode, part string) *muxNode {
+	for _, child := range parent.childConstrained {
+		if child.path == part {
+			return child
+		}
+	}
+	param, constraint := mux.parseConstrainedParam(part)
+	child := &muxNode{path: part, kind: muxNodeParam, param: param, constraint: constraint}
+	parent.childConstrained = append(parent.childConstrained, child)
+	return child
+}
+
+// parseConstrainedParam splits a part like ':id{int}' into the param name and its
+// constraint. Constraints are shared between patterns that use the same expression.
+func (mux *Mux) parseConstrainedParam(part string) (param string, constraint *muxConstraint) {
+	open := strings.IndexByte(part, '{')
+	param, expr := part[1:open], part[open+1:len(part)-1]
+	if param == "" {
+		panic(fmt.Errorf("gopher: mux param %q has no name", part))
+	}
+
+	if constraint = mux.constraints[expr]; constraint != nil {
+		return param, constraint
+	}
+	constraint, err := newMuxConstraint(expr)
+	if err != nil {
+		panic(fmt.Errorf("gopher: mux param %q constraint invalid: %w", part, err))
+	}
+	if mux.constraints == nil {
+		mux.constraints = make(map[string]*muxConstraint)
+	}
+	mux.constraints[expr] = constraint
+	return param, constraint
 }
 
 func (mux *Mux) updateParamsCap(params int) {
@@ -266,63 +518,242 @@ func (mux *Mux) updateParamsCap(params int) {
 
 func (mux *Mux) ServeGopher(ctx context.Context, w ResponseWriter, r *Request) {
 	h, params := mux.findNode(r.url.Selector)
-	if h == nil || h.handler == nil {
+	var handler Handler
+	if h != nil {
+		handler = h.handlerFor(r)
+	}
+	if handler == nil {
+		mux.putParams(params)
 		NotFound(w, r)
 		return
 	}
-	r.Params = params
+	r.Params = nil
+	if params != nil {
+		r.Params = *params
+	}
+	r.mux = mux
 
-	h.handler.ServeGopher(ctx, w, r)
+	handler.ServeGopher(ctx, w, r)
+	mux.putParams(params)
 }
 
 func (mux *Mux) ServeGopherMeta(ctx context.Context, w MetaWriter, r *Request) {
 	h, params := mux.findNode(r.url.Selector)
 
 	if h == nil {
+		mux.putParams(params)
 		w.MetaError(StatusNotFound, fmt.Sprintf("Not found: %q", r.url.Selector))
 		return
 	}
-	if h.meta == nil {
-		h.meta = metaHandlerDefault
+	meta := h.metaFor(r)
+	if meta == nil {
+		meta = metaHandlerDefault
+	}
+	r.Params = nil
+	if params != nil {
+		r.Params = *params
 	}
-	r.Params = params
+	r.mux = mux
 
-	h.meta.ServeGopherMeta(ctx, w, r)
+	meta.ServeGopherMeta(ctx, w, r)
+	mux.putParams(params)
 }
 
 var metaHandlerDefault = MetaHandlerFunc(func(ctx context.Context, mw MetaWriter, rq *Request) {
 	mw.Info(Text, rq.url.Selector, rq.url.Selector)
 })
 
+// muxNode is a node in a compressed radix tree. Fixed path nodes hold an edge of one
+// or more bytes of the normalised pattern, which may span several segments,
+// including the '/' between them, i.e. 'people/' or 'ivities'. Params hang off the
+// end of a node whose path ends with '/', or the root.
 type muxNode struct {
-	part       string
+	// For param nodes, path is the pattern part, i.e. ':id{int}'
+	path       string
 	param      string
-	parent     *muxNode
-	childWild  *muxNode
-	childPaths map[string]*muxNode
 	kind       byte
+	constraint *muxConstraint
+
+	// indices holds the first byte of each child's path, in the same order as children,
+	// so we can find the child to follow without a map:
+	indices  string
+	children []*muxNode
+
+	// Params with constraints, in the order they were added:
+	childConstrained []*muxNode
+	childWild        *muxNode
 
+	pattern string
 	handler Handler
 	meta    MetaHandler
+	info    muxRouteInfo
+
+	// Handlers added with RouteOptions that have conditions, in the order they were
+	// added:
+	routes []*muxRoute
 }
 
+// muxNodeEmpty is found for paths that end on a segment part way along an edge.
+var muxNodeEmpty muxNode
+
 func (m *muxNode) HasAnyHandler() bool {
-	return m.handler != nil || m.meta != nil
+	return m.handler != nil || m.meta != nil || len(m.routes) > 0
+}
+
+// set adds route to the node if it has conditions, otherwise it sets the node's
+// handlers. It returns false if the node already has handlers.
+func (m *muxNode) set(route *muxRoute) bool {
+	if route.conditional() {
+		m.routes = append(m.routes, route)
+		return true
+	}
+	if m.handler != nil || m.meta != nil {
+		return false
+	}
+	m.handler, m.meta, m.info = route.handler, route.meta, route.muxRouteInfo
+	return true
+}
+
+func (m *muxNode) handlerFor(r *Request) Handler {
+	for _, route := range m.routes {
+		if route.handler != nil && route.matches(r) {
+			return route.handler
+		}
+	}
+	return m.handler
+}
+
+func (m *muxNode) metaFor(r *Request) MetaHandler {
+	for _, route := range m.routes {
+		if route.meta != nil && route.matches(r) {
+			return route.meta
+		}
+	}
+	return m.meta
 }
 
 func (m *muxNode) HasChildren() bool {
-	return m.childWild != nil || (m.childPaths != nil && len(m.childPaths) > 0)
+	return m.childWild != nil || len(m.childConstrained) > 0 || len(m.children) > 0
 }
 
-func (m *muxNode) HasChildPaths() bool {
-	return (m.childPaths != nil && len(m.childPaths) > 0)
+func (m *muxNode) matchConstrained(seg string) *muxNode {
+	for _, child := range m.childConstrained {
+		if child.constraint.match(seg) {
+			return child
+		}
+	}
+	return nil
 }
 
-func (m *muxNode) ChildPaths() map[string]*muxNode {
-	if m.childPaths == nil {
-		m.childPaths = map[string]*muxNode{}
+func (m *muxNode) child(c byte) *muxNode {
+	if i := strings.IndexByte(m.indices, c); i >= 0 {
+		return m.children[i]
 	}
-	return m.childPaths
+	return nil
+}
+
+// step follows the byte c from off in m's path, returning the new position, or nil if
+// there is no such edge.
+func (m *muxNode) step(off int, c byte) (*muxNode, int) {
+	if off < len(m.path) {
+		if m.path[off] == c {
+			return m, off + 1
+		}
+		return nil, 0
+	}
+	if next := m.child(c); next != nil {
+		return next, 1
+	}
+	return nil, 0
+}
+
+// matchPath follows the fixed path segment seg from off in m's path. It only matches
+// if seg ends where a pattern had a segment, not part way through a longer one.
+func (m *muxNode) matchPath(off int, seg string) (*muxNode, int) {
+	for len(seg) > 0 {
+		if off == len(m.path) {
+			if m = m.child(seg[0]); m == nil {
+				return nil, 0
+			}
+			off = 0
+		}
+		edge := m.path[off:]
+		n := len(edge)
+		if len(seg) < n {
+			n = len(seg)
+		}
+		if edge[:n] != seg[:n] {
+			return nil, 0
+		}
+		off, seg = off+n, seg[n:]
+	}
+
+	if off < len(m.path) {
+		if m.path[off] != '/' {
+			return nil, 0
+		}
+	} else if !m.HasAnyHandler() && m.child('/') == nil {
+		return nil, 0
+	}
+	return m, off
+}
+
+// after returns the node that holds the params for the segment following a segment
+// that ended at off in m's path, if there is one.
+func (m *muxNode) after(off int) *muxNode {
+	if off < len(m.path) {
+		if off == len(m.path)-1 && m.path[off] == '/' {
+			return m
+		}
+		return nil
+	}
+	if next := m.child('/'); next != nil && next.path == "/" {
+		return next
+	}
+	return nil
+}
+
+// insertPath adds the fixed path s at off in m's path, splitting edges if needed, and
+// returns the position at the end of s.
+func (m *muxNode) insertPath(off int, s string) (*muxNode, int) {
+	for len(s) > 0 {
+		if off == len(m.path) {
+			next := m.child(s[0])
+			if next == nil {
+				next = &muxNode{path: s, kind: muxNodePath}
+				m.indices += s[:1]
+				m.children = append(m.children, next)
+				return next, len(s)
+			}
+			m, off = next, 0
+		}
+
+		n := 0
+		for n < len(s) && off+n < len(m.path) && s[n] == m.path[off+n] {
+			n++
+		}
+		off, s = off+n, s[n:]
+		if len(s) > 0 && off < len(m.path) {
+			m.splitAt(off)
+		}
+	}
+	return m, off
+}
+
+// splitAt splits m's path at off, so that a param or handler can be added at off.
+// Everything m had moves to a new child holding the rest of the path.
+func (m *muxNode) splitAt(off int) *muxNode {
+	if off < len(m.path) {
+		rest := *m
+		rest.path = m.path[off:]
+		*m = muxNode{
+			path:     m.path[:off],
+			kind:     muxNodePath,
+			indices:  rest.path[:1],
+			children: []*muxNode{&rest},
+		}
+	}
+	return m
 }
 
 const (
@@ -350,3 +781,90 @@ func trimSlash(s string) string {
 	}
 	return s[first : last+1]
 }
+
+// ParamDateLayout is the format of params matched by the 'date' constraint.
+const ParamDateLayout = "2006-01-02"
+
+type muxConstraint struct {
+	expr  string
+	match func(seg string) bool
+}
+
+func newMuxConstraint(expr string) (*muxConstraint, error) {
+	switch expr {
+	case "int":
+		return &muxConstraint{expr: expr, match: matchInt}, nil
+	case "uint":
+		return &muxConstraint{expr: expr, match: matchUint}, nil
+	case "date":
+		return &muxConstraint{expr: expr, match: matchDate}, nil
+	case "":
+		return nil, errors.New("empty constraint")
+	}
+
+	rx, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return &muxConstraint{expr: expr, match: rx.MatchString}, nil
+}
+
+func matchInt(seg string) bool {
+	if len(seg) > 0 && seg[0] == '-' {
+		seg = seg[1:]
+	}
+	return matchUint(seg)
+}
+
+func matchUint(seg string) bool {
+	if len(seg) == 0 {
+		return false
+	}
+	for i := 0; i < len(seg); i++ {
+		if seg[i] < '0' || seg[i] > '9' {
+			return false
+		}
+	}
+	if len(seg) > 18 {
+		// Might not fit in an int64; strconv allocates an error if it fails, so we
+		// only use it when we have to:
+		_, err := strconv.ParseUint(seg, 10, 63)
+		return err == nil
+	}
+	return true
+}
+
+func matchDate(seg string) bool {
+	if len(seg) != len(ParamDateLayout) || seg[4] != '-' || seg[7] != '-' {
+		return false
+	}
+	_, err := time.Parse(ParamDateLayout, seg)
+	return err == nil
+}
+
+func isConstrainedParam(part string) bool {
+	return len(part) > 0 && part[0] == ':' && part[len(part)-1] == '}' && strings.IndexByte(part, '{') > 0
+}
+
+// splitMuxPattern splits a pattern on '/', except inside a param constraint, so that
+// regular expressions like '{[^/]+}' survive.
+func splitMuxPattern(pattern string) []string {
+	var parts []string
+	var depth, start int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case '/':
+			if depth == 0 {
+				parts = append(parts, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, pattern[start:])
+}
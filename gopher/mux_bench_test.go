@@ -20,6 +20,14 @@ func BenchmarkMux_Param5(b *testing.B) {
 	benchRequest(b, mux, "/test/test/test/test/test")
 }
 
+func BenchmarkMux_ParamConstraint(b *testing.B) {
+	mux := NewMux()
+	mux.Handle("/:a{int}", nilHandler, nil)
+	mux.Handle("/:a", nilHandler, nil)
+
+	benchRequest(b, mux, "/test")
+}
+
 func BenchmarkMux_GPlusStatic(b *testing.B) {
 	var h dummyHandler
 	defer h.assertCalled(b)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
 	"reflect"
 	"runtime"
@@ -117,6 +118,89 @@ func TestMuxParamHandler(t *testing.T) {
 	testAllHandled(t, missed, "foo/:p1", "foo/")
 }
 
+func TestMuxParamConstraints(t *testing.T) {
+	testAllHandled(t, handledParams{{"id", "123"}}, "post/:id{int}", "post/123")
+	testAllHandled(t, handledParams{{"id", "-123"}}, "post/:id{int}", "post/-123")
+	testAllHandled(t, missed, "post/:id{int}", "post/12a")
+	testAllHandled(t, missed, "post/:id{uint}", "post/-123")
+	testAllHandled(t, missed, "post/:id{int}", "post/99999999999999999999")
+	testAllHandled(t, handledParams{{"d", "2020-02-29"}}, "post/:d{date}", "post/2020-02-29")
+	testAllHandled(t, missed, "post/:d{date}", "post/2021-02-29")
+	testAllHandled(t, handledParams{{"slug", "foo-1"}}, "post/:slug{[a-z0-9-]+}", "post/foo-1")
+	testAllHandled(t, missed, "post/:slug{[a-z0-9-]+}", "post/Foo")
+	testAllHandled(t, missed, "post/:slug{[a-z]+}", "post/foo1")
+	testAllHandled(t, handledParams{{"y", "2020"}, {"rest", "x"}}, "post/:y{[0-9]{4}}/*rest", "post/2020/x")
+	testAllHandled(t, handledParams{{"s", "a"}}, "post/:s{[^/]+}", "post/a")
+
+	// Falls through to the unconstrained param or catch-all:
+	testAllHandled(t, handledParams{{"other", "foo"}}, "post/:other", "post/foo",
+		otherRoute("post/:id{int}"))
+	testAllHandled(t, handledParams{{"rest", "foo/bar"}}, "post/*rest", "post/foo/bar",
+		otherRoute("post/:id{int}"))
+	testAllHandled(t, handledParams{{"id", "1"}}, "post/:id{int}", "post/1",
+		otherRoute("post/:slug"))
+
+	// Once a constraint matches, it is not undone if nothing below it matches, in the
+	// same way as fixed paths:
+	testAllHandled(t, missed, "post/*rest", "post/1",
+		otherRoute("post/:id{int}/yep"))
+}
+
+func TestMuxParamConstraintsOrder(t *testing.T) {
+	var d1, d2, d3 dummyHandler
+	m := NewMux()
+	m.Handle("/post/:id{int}", &d1, nil)
+	m.Handle("/post/:slug{[a-z0-9-]+}", &d2, nil)
+	m.Handle("/post/:other", &d3, nil)
+	m.Handle("/post/:id{int}/comments", &d1, nil)
+
+	assertNode(t, m, "/post/123", &d1)
+	assertNode(t, m, "/post/123/comments", &d1)
+	assertNode(t, m, "/post/hello-world", &d2)
+	assertNode(t, m, "/post/Hello", &d3)
+
+	_, params := m.findNode("/post/123/comments")
+	if id, err := params.Int("id"); err != nil || id != 123 {
+		t.Fatal(id, err)
+	}
+}
+
+func TestMuxParamConstraintsInvalid(t *testing.T) {
+	assertPanic(t, func() {
+		NewMux().Handle("/post/:id{[}", nilHandler, nil)
+	})
+	assertPanic(t, func() {
+		NewMux().Handle("/post/:{int}", nilHandler, nil)
+	})
+	assertPanic(t, func() {
+		m := NewMux()
+		m.Handle("/post/:id{int}", nilHandler, nil)
+		m.Handle("/post/:id{int}", nilHandler, nil)
+	})
+}
+
+func TestParamsTyped(t *testing.T) {
+	params := Params{{"id", "-12"}, {"n", "18446744073709551615"}, {"d", "2020-02-29"}, {"s", "yep"}}
+	if v, err := params.Int("id"); err != nil || v != -12 {
+		t.Fatal(v, err)
+	}
+	if v, err := params.Uint64("n"); err != nil || v != 18446744073709551615 {
+		t.Fatal(v, err)
+	}
+	if v, err := params.Time("d", ""); err != nil || v.Format("2006-01-02") != "2020-02-29" {
+		t.Fatal(v, err)
+	}
+	if _, err := params.Int("s"); err == nil {
+		t.Fatal()
+	}
+	if _, err := params.Int64("nope"); err == nil {
+		t.Fatal()
+	}
+	if _, err := params.Time("s", ParamDateLayout); err == nil {
+		t.Fatal()
+	}
+}
+
 func TestMuxCatchAll(t *testing.T) {
 	testAllHandled(t, handledParams{{"p1", ""}}, "*p1", "")
 
@@ -155,6 +239,117 @@ func TestMuxCatchAll(t *testing.T) {
 	)
 }
 
+func TestMuxSharedPrefix(t *testing.T) {
+	// Patterns that share a prefix share an edge in the tree, which must not let
+	// selectors match part of a segment:
+	testAllHandled(t, missed, "foobar", "foo", otherRoute("foobaz"))
+	testAllHandled(t, missed, "foobar", "fooba", otherRoute("foobaz"))
+	testAllHandled(t, handled, "foo", "foo", otherRoute("foobar"))
+	testAllHandled(t, handled, "foo/bar", "foo/bar", otherRoute("foo"), otherRoute("foobar"))
+	testAllHandled(t, handledParams{{"p1", "ba"}}, "foo/:p1", "foo/ba", otherRoute("foo/bar"), otherRoute("foo/baz"))
+	testAllHandled(t, handledParams{{"p1", "barr"}}, "foo/:p1", "foo/barr", otherRoute("foo/bar"))
+
+	// A selector that ends part way along an edge has no handler, and doesn't fall
+	// back to the catch-all, the same as any other node without a handler:
+	testAllHandled(t, missed, "foo/*p1", "foo/bar", otherRoute("foo/bar/baz"))
+	testAllHandled(t, handledParams{{"p1", "bar/qux"}}, "foo/*p1", "foo/bar/qux", otherRoute("foo/bar/baz"))
+	testAllHandled(t, handledParams{{"p1", "ba"}}, "foo/*p1", "foo/ba", otherRoute("foo/bar/baz"))
+}
+
+func TestMuxAllocs(t *testing.T) {
+	mux := NewMux()
+	for _, path := range gplusAPI {
+		mux.Handle(path, nilHandler, nil)
+	}
+
+	ctx := context.Background()
+	for _, sel := range []string{"/people", "/people/118051310819094153327/activities/123456789"} {
+		rq := NewRequest(URL{Selector: sel}, nil)
+		allocs := testing.AllocsPerRun(100, func() {
+			mux.ServeGopher(ctx, ioutil.Discard, rq)
+		})
+		if allocs != 0 {
+			t.Fatal(sel, allocs)
+		}
+	}
+}
+
+func TestMuxSelector(t *testing.T) {
+	m := NewMux()
+	m.HandleNamed("root", "/", nilHandler, nil)
+	m.HandleNamed("user", "/user/:user", nilHandler, nil)
+	m.HandleNamed("file", "/user/:user/files/*path", nilHandler, nil)
+	m.HandleNamed("post", "/post/:id{int}", nilHandler, nil)
+
+	for idx, tc := range []struct {
+		name   string
+		params []string
+		out    string
+		ok     bool
+	}{
+		{"root", nil, "/", true},
+		{"user", []string{"user", "gordon"}, "/user/gordon", true},
+		{"file", []string{"user", "gordon", "path", "docs/readme.txt"}, "/user/gordon/files/docs/readme.txt", true},
+		{"file", []string{"path", "/docs/", "user", "gordon"}, "/user/gordon/files/docs/", true},
+		{"file", []string{"user", "gordon", "path", ""}, "/user/gordon/files/", true},
+		{"post", []string{"id", "12"}, "/post/12", true},
+
+		{"nope", nil, "", false},
+		{"user", nil, "", false},
+		{"user", []string{"user"}, "", false},
+		{"user", []string{"user", ""}, "", false},
+		{"user", []string{"user", "a/b"}, "", false},
+		{"user", []string{"user", "a\tb"}, "", false},
+		{"user", []string{"user", "gordon", "extra", "yep"}, "", false},
+		{"file", []string{"user", "gordon", "path", "a\r\n"}, "", false},
+		{"post", []string{"id", "yep"}, "", false},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			sel, err := m.Selector(tc.name, tc.params...)
+			if (err == nil) != tc.ok {
+				t.Fatal(err)
+			}
+			if sel != tc.out {
+				t.Fatalf("%q != %q", sel, tc.out)
+			}
+			if tc.ok {
+				if node, _ := m.findNode(sel); node == nil || node.handler == nil {
+					t.Fatalf("%q did not match", sel)
+				}
+			}
+		})
+	}
+
+	assertPanic(t, func() {
+		m.HandleNamed("user", "/other/:user", nilHandler, nil)
+	})
+}
+
+func TestMuxRequestSelector(t *testing.T) {
+	var out bytes.Buffer
+	m := NewMux()
+	m.HandleNamed("user", "/user/:user", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		sel, err := r.Selector("user", "user", "you")
+		if err != nil || sel != "/prefix/user/you" {
+			t.Fatal(sel, err)
+		}
+		dw := NewDirWriter(w, r)
+		dw.Route(Dir, "You", "user", "user", "you")
+		dw.MustFlush()
+	}), nil)
+
+	rq := NewRequest(URL{Hostname: "localhost", Port: "70", Selector: "/user/gordon"}, nil)
+	rq.SelectorPrefix = "/prefix"
+	m.ServeGopher(context.Background(), &out, rq)
+	if out.String() != "1You\t/prefix/user/you\tlocalhost\t70\r\n.\r\n" {
+		t.Fatalf("%q", out.String())
+	}
+
+	if _, err := NewRequest(URL{}, nil).Selector("user"); err == nil {
+		t.Fatal()
+	}
+}
+
 func TestTrimSlash(t *testing.T) {
 	for idx, tc := range []struct {
 		in  string
@@ -0,0 +1,155 @@
+package gopher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// muxMountParam is the name of the catch-all param used by Mount, which makes the
+// pattern part '**'. Nobody should be writing that by hand.
+const muxMountParam = "*"
+
+// Mount serves everything at and below prefix with h. h sees selectors relative to the
+// mount point, and the mount point is added to the Request's SelectorPrefix, so a
+// DirWriter in h builds selectors that lead back through this Mux:
+//
+//	mux.Mount("/files", gopherfs.New(gopherfs.Dir("/srv/files"), "/"))
+//	mux.Mount("/phlog", phlogMux)
+//
+// A request for '/files/foo.txt' reaches the FileServer as '/foo.txt'; a request for
+// '/files' reaches it as the root selector.
+//
+// Prefix must not contain params. Mount panics if prefix conflicts with an existing
+// pattern, in the same way as Handle.
+//
+// If h implements MetaHandler, meta requests are mounted too.
+func (mux *Mux) Mount(prefix string, h Handler) {
+	mux.mount(prefix, h, h)
+}
+
+// mount mounts h at prefix, but serves requests with serve, which may be h wrapped in
+// middleware. h is what MuxRoute.Mount reports, and what receives meta requests.
+func (mux *Mux) mount(prefix string, h Handler, serve Handler) {
+	prefix = trimSlash(prefix)
+	if strings.ContainsAny(prefix, ":*") {
+		panic(fmt.Errorf("gopher: mux mount prefix %q must not contain params", prefix))
+	}
+
+	mount := &muxMount{prefix: "/" + prefix, h: h, serve: serve}
+	var meta MetaHandler
+	if mh, ok := h.(MetaHandler); ok {
+		mount.meta = mh
+		meta = mount
+	}
+	mux.Handle(prefix+"/*"+muxMountParam, mount, meta)
+}
+
+type muxMount struct {
+	prefix string
+	h      Handler
+	serve  Handler
+	meta   MetaHandler
+}
+
+func (mm *muxMount) strip(r *Request) *Request {
+	var rest string
+	if n := len(r.Params); n > 0 && r.Params[n-1].Key == muxMountParam {
+		rest = r.Params[n-1].Value
+	}
+
+	r2 := *r
+	r2.Params = nil
+	r2.url.Root = rest == ""
+	if rest == "" {
+		r2.url.Selector = ""
+	} else {
+		r2.url.Selector = "/" + rest
+		if strings.HasSuffix(r.url.Selector, "/") {
+			r2.url.Selector += "/"
+		}
+	}
+	if mm.prefix != "/" {
+		r2.SelectorPrefix = r.SelectorPrefix + mm.prefix
+	}
+	return &r2
+}
+
+func (mm *muxMount) ServeGopher(ctx context.Context, w ResponseWriter, r *Request) {
+	mm.serve.ServeGopher(ctx, w, mm.strip(r))
+}
+
+func (mm *muxMount) ServeGopherMeta(ctx context.Context, w MetaWriter, r *Request) {
+	mm.meta.ServeGopherMeta(ctx, w, mm.strip(r))
+}
+
+// MuxGroup adds routes to a Mux under a common prefix, with common middleware. Create
+// one with Mux.Group().
+type MuxGroup struct {
+	mux    *Mux
+	prefix string
+	mw     []Middleware
+}
+
+// Group returns a MuxGroup that adds prefix to the patterns passed to its methods, and
+// wraps their Handlers with mw:
+//
+//	admin := mux.Group("/admin", gopher.Recover(log))
+//	admin.Handle("/users/:user", usersHandler, nil) // Handles '/admin/users/:user'
+//	admin.Mount("/files", fileServer)               // Mounts at '/admin/files'
+//
+// The prefix may contain params, but then Mount can't be used with the group.
+// Middleware is not applied to MetaHandlers.
+func (mux *Mux) Group(prefix string, mw ...Middleware) *MuxGroup {
+	return &MuxGroup{mux: mux, prefix: trimSlash(prefix), mw: mw}
+}
+
+// Group returns a MuxGroup nested inside this one; its prefix and middleware are added
+// to this group's.
+func (g *MuxGroup) Group(prefix string, mw ...Middleware) *MuxGroup {
+	all := make([]Middleware, 0, len(g.mw)+len(mw))
+	all = append(all, g.mw...)
+	all = append(all, mw...)
+	return &MuxGroup{mux: g.mux, prefix: g.pattern(prefix), mw: all}
+}
+
+func (g *MuxGroup) pattern(pattern string) string {
+	pattern = trimSlash(pattern)
+	if pattern == "" {
+		return g.prefix
+	}
+	if g.prefix == "" {
+		return pattern
+	}
+	return g.prefix + "/" + pattern
+}
+
+func (g *MuxGroup) wrap(handler Handler) Handler {
+	if handler == nil || len(g.mw) == 0 {
+		return handler
+	}
+	return Chain(handler, g.mw...)
+}
+
+// Handle is the same as Mux.Handle, but with the group's prefix and middleware.
+func (g *MuxGroup) Handle(pattern string, handler Handler, meta MetaHandler, opts ...RouteOption) {
+	g.mux.Handle(g.pattern(pattern), g.wrap(handler), meta, opts...)
+}
+
+// HandleNamed is the same as Mux.HandleNamed, but with the group's prefix and
+// middleware.
+func (g *MuxGroup) HandleNamed(name, pattern string, handler Handler, meta MetaHandler, opts ...RouteOption) {
+	g.mux.HandleNamed(name, g.pattern(pattern), g.wrap(handler), meta, opts...)
+}
+
+// HandleSearch is the same as Mux.HandleSearch, but with the group's prefix and
+// middleware.
+func (g *MuxGroup) HandleSearch(pattern string, search SearchHandlerFunc, help Handler, opts ...RouteOption) {
+	g.Handle(pattern, searchHelpHandler(help), nil, withRouteSearch(opts, false)...)
+	g.Handle(pattern, searchHandler(search), nil, withRouteSearch(opts, true)...)
+}
+
+// Mount is the same as Mux.Mount, but with the group's prefix and middleware.
+func (g *MuxGroup) Mount(prefix string, h Handler) {
+	g.mux.mount(g.pattern(prefix), h, g.wrap(h))
+}
@@ -0,0 +1,122 @@
+package gopher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMuxMount(t *testing.T) {
+	var sel, prefix string
+	var root bool
+	inner := NewMux()
+	inner.HandleNamed("file", "/*path", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		sel, prefix, root = r.url.Selector, r.SelectorPrefix, r.url.Root
+		s, _ := r.Selector("file", "path", "x.txt")
+		w.Write([]byte(s))
+	}), nil)
+
+	mux := NewMux()
+	mux.Handle("/fil", nilHandler, nil)
+	mux.Mount("/files/", inner)
+
+	for idx, tc := range []struct {
+		in     string
+		sel    string
+		prefix string
+		root   bool
+	}{
+		{"/files/foo.txt", "/foo.txt", "/pfx/files", false},
+		{"/files/sub/", "/sub/", "/pfx/files", false},
+		{"/files/sub/foo.txt", "/sub/foo.txt", "/pfx/files", false},
+		{"/files", "", "/pfx/files", true},
+		{"/files/", "", "/pfx/files", true},
+		{"files/foo.txt", "/foo.txt", "/pfx/files", false},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			sel, prefix, root = "<unset>", "<unset>", false
+			var out bytes.Buffer
+			rq := NewRequest(URL{Selector: tc.in}, nil)
+			rq.SelectorPrefix = "/pfx"
+			mux.ServeGopher(context.Background(), &out, rq)
+			if sel != tc.sel || prefix != tc.prefix || root != tc.root {
+				t.Fatalf("%q %q %v", sel, prefix, root)
+			}
+			if out.String() != "/pfx/files/x.txt" {
+				t.Fatalf("%q", out.String())
+			}
+		})
+	}
+
+	// Meta requests are mounted too, as Mux is a MetaHandler:
+	rq := NewRequest(URL{Selector: "/files/foo.txt"}.AsMetaItem(), nil)
+	var out bytes.Buffer
+	mux.ServeGopherMeta(context.Background(), newMetaWriter(&out, rq), rq)
+	if !strings.Contains(out.String(), "/foo.txt") {
+		t.Fatalf("%q", out.String())
+	}
+}
+
+func TestMuxMountConflict(t *testing.T) {
+	assertPanic(t, func() {
+		mux := NewMux()
+		mux.Mount("/files", nilHandler)
+		mux.Mount("/files", nilHandler)
+	})
+	assertPanic(t, func() {
+		NewMux().Mount("/user/:user", nilHandler)
+	})
+	assertPanic(t, func() {
+		NewMux().Group("/user/:user").Mount("/files", nilHandler)
+	})
+}
+
+func TestMuxGroup(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+				order = append(order, name)
+				h.ServeGopher(ctx, w, r)
+			})
+		}
+	}
+	handler := func(name string) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			order = append(order, name+":"+r.Params.Get("user"))
+		})
+	}
+
+	mux := NewMux()
+	admin := mux.Group("/admin/", mw("a"))
+	admin.Handle("/", handler("index"), nil)
+	admin.Handle("/users/:user", handler("user"), nil)
+	admin.Group("/deep", mw("b")).HandleNamed("deep", "/:user", handler("deep"), nil)
+	admin.Mount("/files", handler("files"))
+	mux.Group("/plain").Handle("/x", handler("plain"), nil)
+
+	for idx, tc := range []struct {
+		in  string
+		out string
+	}{
+		{"/admin", "a,index:"},
+		{"/admin/users/gordon", "a,user:gordon"},
+		{"/admin/deep/you", "a,b,deep:you"},
+		{"/admin/files/foo.txt", "a,files:"},
+		{"/plain/x", "plain:"},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			order = nil
+			mux.ServeGopher(context.Background(), &bytes.Buffer{}, NewRequest(URL{Selector: tc.in}, nil))
+			if strings.Join(order, ",") != tc.out {
+				t.Fatal(order)
+			}
+		})
+	}
+
+	if sel, err := mux.Selector("deep", "user", "you"); err != nil || sel != "/admin/deep/you" {
+		t.Fatal(sel, err)
+	}
+}
@@ -0,0 +1,280 @@
+package gopher
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RouteOption configures a pattern passed to Mux.Handle().
+//
+// Most RouteOptions add a condition, so that a single pattern can be served by
+// different handlers depending on the request:
+//
+//	mux.Handle("/search", helpHandler, nil, gopher.RouteSearch(false))
+//	mux.Handle("/search", resultsHandler, nil, gopher.RouteSearch(true))
+type RouteOption func(route *muxRoute)
+
+// RouteItem describes the item served by the route, for SitemapHandler and Mux.Routes().
+// If disp is empty, the last segment of the pattern is used. RouteItem does not add a
+// condition.
+func RouteItem(i ItemType, disp string) RouteOption {
+	return func(route *muxRoute) {
+		route.itemType, route.display = i, disp
+	}
+}
+
+func routeName(name string) RouteOption {
+	return func(route *muxRoute) {
+		route.name = name
+	}
+}
+
+// RouteSearch matches requests with a Search if present is true, or without a Search
+// if present is false. The Search of a meta request is not counted as a Search.
+func RouteSearch(present bool) RouteOption {
+	return func(route *muxRoute) {
+		if present {
+			route.search = muxRouteYes
+		} else {
+			route.search = muxRouteNo
+		}
+	}
+}
+
+// RouteSearchRegexp matches requests whose Search matches rx. Use anchors to match
+// the whole Search. The Search of a meta request is treated as empty.
+func RouteSearchRegexp(rx *regexp.Regexp) RouteOption {
+	return func(route *muxRoute) {
+		route.searchRx = rx
+	}
+}
+
+// RouteMeta matches meta requests if meta is true, or requests that are not meta
+// requests if meta is false. See URL.IsMeta().
+func RouteMeta(meta bool) RouteOption {
+	return func(route *muxRoute) {
+		if meta {
+			route.isMeta = muxRouteYes
+		} else {
+			route.isMeta = muxRouteNo
+		}
+	}
+}
+
+const (
+	muxRouteAny int8 = 0
+	muxRouteYes int8 = 1
+	muxRouteNo  int8 = -1
+)
+
+type muxRoute struct {
+	muxRouteInfo
+	handler Handler
+	meta    MetaHandler
+
+	search   int8
+	searchRx *regexp.Regexp
+	isMeta   int8
+}
+
+// muxRouteInfo describes a route without affecting which requests it matches.
+type muxRouteInfo struct {
+	name     string
+	itemType ItemType
+	display  string
+}
+
+func (route *muxRoute) conditional() bool {
+	return route.search != muxRouteAny || route.searchRx != nil || route.isMeta != muxRouteAny
+}
+
+func (route *muxRoute) matches(r *Request) bool {
+	isMeta := r.url.IsMeta()
+	if route.isMeta != muxRouteAny && (route.isMeta == muxRouteYes) != isMeta {
+		return false
+	}
+
+	search := r.url.Search
+	if isMeta {
+		search = ""
+	}
+	if route.search != muxRouteAny && (route.search == muxRouteYes) != (search != "") {
+		return false
+	}
+	if route.searchRx != nil && !route.searchRx.MatchString(search) {
+		return false
+	}
+	return true
+}
+
+// SearchHandlerFunc handles a request with a Search, which has been split into terms by
+// ParseSearchTerms.
+type SearchHandlerFunc func(ctx context.Context, w ResponseWriter, r *Request, terms []string)
+
+// HandleSearch handles a search endpoint (item type 7) at pattern. Requests with a
+// Search are passed to search, along with the terms in the Search. Requests without a
+// Search are passed to help, which should explain what can be searched for; if help is
+// nil, those requests receive a StatusBadRequest error.
+//
+// Additional RouteOptions apply to both handlers.
+func (mux *Mux) HandleSearch(pattern string, search SearchHandlerFunc, help Handler, opts ...RouteOption) {
+	mux.Handle(pattern, searchHelpHandler(help), nil, withRouteSearch(opts, false)...)
+	mux.Handle(pattern, searchHandler(search), nil, withRouteSearch(opts, true)...)
+}
+
+func searchHandler(search SearchHandlerFunc) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		search(ctx, w, r, ParseSearchTerms(r.url.Search))
+	})
+}
+
+func searchHelpHandler(help Handler) Handler {
+	if help == nil {
+		return searchRequired
+	}
+	return help
+}
+
+// withRouteSearch returns a copy of opts with RouteSearch(present) added.
+func withRouteSearch(opts []RouteOption, present bool) []RouteOption {
+	return append(opts[:len(opts):len(opts)], RouteSearch(present))
+}
+
+var searchRequired = HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+	if err := RespondError(w, r, StatusBadRequest, "Search required"); err != nil {
+		panic(err)
+	}
+})
+
+// ParseSearchTerms splits a Search into terms on whitespace. Double-quoted phrases are
+// kept together as a single term, without the quotes:
+//
+//	ParseSearchTerms(`foo "bar baz" qux`) // []string{"foo", "bar baz", "qux"}
+//
+// An unterminated quote runs to the end of the Search.
+func ParseSearchTerms(search string) []string {
+	var terms []string
+	var quoted bool
+	var start = -1
+
+	for i := 0; i <= len(search); i++ {
+		var c byte
+		if i < len(search) {
+			c = search[i]
+		}
+
+		switch {
+		case c == '"' && quoted:
+			if start < i {
+				terms = append(terms, search[start:i])
+			}
+			quoted, start = false, -1
+
+		case i == len(search) || (!quoted && (c == '"' || isSearchSpace(c))):
+			if start >= 0 {
+				if term := strings.TrimSpace(search[start:i]); term != "" {
+					terms = append(terms, term)
+				}
+				start = -1
+			}
+			if c == '"' {
+				quoted, start = true, i+1
+			}
+
+		case start < 0:
+			start = i
+		}
+	}
+	return terms
+}
+
+func isSearchSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f'
+}
+
+// MuxRoute describes a route registered with a Mux. See Mux.Routes().
+type MuxRoute struct {
+	// Pattern, normalised to start with a single '/', i.e. '/user/:user'. For routes
+	// added with Mount(), this is the mount prefix.
+	Pattern string
+
+	// Name, if the route was added with HandleNamed().
+	Name string
+
+	// ItemType and Display from RouteItem(). ItemType is NoItemType if RouteItem() was
+	// not used.
+	ItemType ItemType
+	Display  string
+
+	// Whether the route has a Handler and/or a MetaHandler.
+	Handler bool
+	Meta    bool
+
+	// Set if the route has RouteOptions that limit which requests it matches.
+	Conditional bool
+
+	// Set to the mounted Handler if the route was added with Mount().
+	Mount Handler
+}
+
+// IsStatic reports whether the route's Pattern contains no params, i.e. it matches a
+// single selector.
+func (mr *MuxRoute) IsStatic() bool {
+	return mr.Mount == nil && !strings.ContainsAny(mr.Pattern, ":*")
+}
+
+// Routes returns all of the routes registered with the Mux. Routes are sorted by their
+// fixed path segments; params and catch-alls come after the fixed paths that share
+// their prefix. For a pattern added with RouteOptions, the routes with conditions come
+// first, in the order they were added.
+func (mux *Mux) Routes() []MuxRoute {
+	var routes []MuxRoute
+	mux.root.walkRoutes(&routes)
+	return routes
+}
+
+func (m *muxNode) walkRoutes(routes *[]MuxRoute) {
+	for _, route := range m.routes {
+		*routes = append(*routes, newMuxRoute(m.pattern, &route.muxRouteInfo, route.handler, route.meta, true))
+	}
+	if m.handler != nil || m.meta != nil {
+		mr := newMuxRoute(m.pattern, &m.info, m.handler, m.meta, false)
+		if mount, ok := m.handler.(*muxMount); ok && m.param == muxMountParam {
+			mr.Pattern, mr.Mount = mount.prefix, mount.h
+		}
+		*routes = append(*routes, mr)
+	}
+
+	if len(m.children) > 0 {
+		children := append([]*muxNode(nil), m.children...)
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].path < children[j].path
+		})
+		for _, child := range children {
+			child.walkRoutes(routes)
+		}
+	}
+	for _, child := range m.childConstrained {
+		child.walkRoutes(routes)
+	}
+	if m.childWild != nil {
+		m.childWild.walkRoutes(routes)
+	}
+}
+
+func newMuxRoute(pattern string, info *muxRouteInfo, handler Handler, meta MetaHandler, conditional bool) MuxRoute {
+	if pattern == "" {
+		pattern = "/"
+	}
+	return MuxRoute{
+		Pattern:     pattern,
+		Name:        info.name,
+		ItemType:    info.itemType,
+		Display:     info.display,
+		Handler:     handler != nil,
+		Meta:        meta != nil,
+		Conditional: conditional,
+	}
+}
@@ -0,0 +1,182 @@
+package gopher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func testNamedHandler(name string) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func TestMuxRouteOptions(t *testing.T) {
+	mux := NewMux()
+	mux.Handle("/find", testNamedHandler("id"), nil, RouteSearchRegexp(regexp.MustCompile(`^[0-9]+$`)))
+	mux.Handle("/find", testNamedHandler("help"), nil, RouteSearch(false))
+	mux.Handle("/find", testNamedHandler("search"), nil, RouteSearch(true))
+	mux.Handle("/only", testNamedHandler("search"), nil, RouteSearch(true))
+	mux.Handle("/only/*rest", testNamedHandler("rest"), nil, RouteSearch(true))
+	mux.Handle("/both", testNamedHandler("plain"), nil)
+	mux.Handle("/both", testNamedHandler("search"), nil, RouteSearch(true))
+
+	for idx, tc := range []struct {
+		sel    string
+		search string
+		out    string
+	}{
+		{"/find", "", "help"},
+		{"/find", "foo", "search"},
+		{"/find", "123", "id"},
+		{"/only", "foo", "search"},
+		{"/only", "", "3"},
+		{"/only/yep", "foo", "rest"},
+		{"/only/yep", "", "3"},
+		{"/both", "", "plain"},
+		{"/both", "foo", "search"},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			var out bytes.Buffer
+			mux.ServeGopher(context.Background(), &out, NewRequest(URL{Selector: tc.sel, Search: tc.search}, nil))
+			if !strings.HasPrefix(out.String(), tc.out) {
+				t.Fatalf("%q", out.String())
+			}
+		})
+	}
+
+	// Conditional routes don't conflict with each other, but the unconditional handler
+	// still can't be set twice:
+	assertPanic(t, func() {
+		mux.Handle("/both", nilHandler, nil)
+	})
+}
+
+func TestMuxRouteMeta(t *testing.T) {
+	var called string
+	meta := func(name string) MetaHandler {
+		return MetaHandlerFunc(func(ctx context.Context, w MetaWriter, r *Request) {
+			called = name
+		})
+	}
+
+	mux := NewMux()
+	mux.Handle("/find", nil, meta("help"), RouteSearch(false))
+	mux.Handle("/find", nil, meta("meta"), RouteMeta(true))
+	mux.Handle("/plain", nil, meta("plain"), RouteMeta(false))
+
+	rq := NewRequest(URL{Selector: "/find"}.AsMetaItem(), nil)
+	mux.ServeGopherMeta(context.Background(), newMetaWriter(&bytes.Buffer{}, rq), rq)
+	if called != "help" {
+		t.Fatal(called)
+	}
+
+	// Falls back to the default MetaHandler:
+	called = ""
+	rq = NewRequest(URL{Selector: "/plain"}.AsMetaItem(), nil)
+	mux.ServeGopherMeta(context.Background(), newMetaWriter(&bytes.Buffer{}, rq), rq)
+	if called != "" {
+		t.Fatal(called)
+	}
+}
+
+func TestMuxHandleSearch(t *testing.T) {
+	var terms []string
+	mux := NewMux()
+	mux.HandleSearch("/search", func(ctx context.Context, w ResponseWriter, r *Request, t []string) {
+		terms = t
+		w.Write([]byte("results"))
+	}, testNamedHandler("help"))
+	mux.HandleSearch("/nohelp", func(ctx context.Context, w ResponseWriter, r *Request, t []string) {}, nil)
+	mux.Group("/group").HandleSearch("/search", func(ctx context.Context, w ResponseWriter, r *Request, t []string) {
+		terms = t
+	}, nil)
+
+	var out bytes.Buffer
+	mux.ServeGopher(context.Background(), &out, NewRequest(URL{Selector: "/search"}, nil))
+	if out.String() != "help" {
+		t.Fatalf("%q", out.String())
+	}
+
+	out.Reset()
+	mux.ServeGopher(context.Background(), &out, NewRequest(URL{Selector: "/search", Search: `foo "bar baz"`}, nil))
+	if out.String() != "results" || !reflect.DeepEqual(terms, []string{"foo", "bar baz"}) {
+		t.Fatalf("%q %q", out.String(), terms)
+	}
+
+	out.Reset()
+	mux.ServeGopher(context.Background(), &out, NewRequest(URL{Selector: "/nohelp"}, nil))
+	if !strings.HasPrefix(out.String(), "3") || !strings.Contains(out.String(), "Search required") {
+		t.Fatalf("%q", out.String())
+	}
+
+	terms = nil
+	mux.ServeGopher(context.Background(), &bytes.Buffer{}, NewRequest(URL{Selector: "/group/search", Search: "yep"}, nil))
+	if !reflect.DeepEqual(terms, []string{"yep"}) {
+		t.Fatal(terms)
+	}
+}
+
+func TestParseSearchTerms(t *testing.T) {
+	for idx, tc := range []struct {
+		in  string
+		out []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"foo", []string{"foo"}},
+		{"  foo \t bar  ", []string{"foo", "bar"}},
+		{`foo "bar baz" qux`, []string{"foo", "bar baz", "qux"}},
+		{`"bar  baz"`, []string{"bar  baz"}},
+		{`foo"bar"baz`, []string{"foo", "bar", "baz"}},
+		{`"" foo`, []string{"foo"}},
+		{`foo "bar baz`, []string{"foo", "bar baz"}},
+		{`foo "`, []string{"foo"}},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			terms := ParseSearchTerms(tc.in)
+			if !reflect.DeepEqual(terms, tc.out) {
+				t.Fatalf("%q != %q", terms, tc.out)
+			}
+		})
+	}
+}
+
+func TestMuxRoutes(t *testing.T) {
+	inner := NewMux()
+	inner.Handle("/a.txt", nilHandler, nil)
+
+	mux := NewMux()
+	mux.Handle("/", nilHandler, nil, RouteItem(Dir, "Home"))
+	mux.HandleNamed("user", "/user/:user", nilHandler, nilMetaHandler)
+	mux.Handle("/find", nilHandler, nil, RouteSearch(true), RouteItem(Search, "Find"))
+	mux.Handle("/find", nil, nilMetaHandler)
+	mux.Handle("/about.txt", nilHandler, nil, RouteItem(Text, ""))
+	mux.Handle("/post/:id{int}", nilHandler, nil)
+	mux.Handle("/post/*rest", nilHandler, nil)
+	mux.Mount("/files", inner)
+
+	expected := []MuxRoute{
+		{Pattern: "/", ItemType: Dir, Display: "Home", Handler: true},
+		{Pattern: "/about.txt", ItemType: Text, Handler: true},
+		{Pattern: "/files", Handler: true, Meta: true, Mount: inner},
+		{Pattern: "/find", ItemType: Search, Display: "Find", Handler: true, Conditional: true},
+		{Pattern: "/find", Meta: true},
+		{Pattern: "/post/:id{int}", Handler: true},
+		{Pattern: "/post/*rest", Handler: true},
+		{Pattern: "/user/:user", Name: "user", Handler: true, Meta: true},
+	}
+	routes := mux.Routes()
+	if !reflect.DeepEqual(routes, expected) {
+		t.Fatalf("%+v", routes)
+	}
+
+	if !routes[1].IsStatic() || routes[2].IsStatic() || routes[5].IsStatic() {
+		t.Fatal()
+	}
+}
@@ -0,0 +1,137 @@
+package gopher
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	// The response is terminated by a '.' on a line by itself, like text and
+	// directories.
+	PlusSizeTerminated int64 = -1
+
+	// The client should read until the server closes the connection.
+	PlusSizeUntilClose int64 = -2
+)
+
+var errPlusAlreadyBegan = errors.New("gopher: gopher+ response header already sent")
+
+// PlusResponseWriter wraps a ResponseWriter for a Gopher+ client. The Gopher+ header
+// line is written before the first byte of the response:
+//
+//	+-1     the response is terminated by a '.' on a line by itself
+//	+-2     the client should read until the connection is closed
+//	+<n>    exactly <n> bytes follow
+//
+// Server uses a PlusResponseWriter for all non-metadata Gopher+ requests, so existing
+// Handlers will work with Gopher+ clients without modification. TextWriter and
+// DirWriter will set the size to PlusSizeTerminated if nothing has been written yet.
+// Handlers that know the length of the response in advance should call SetSize() before
+// writing anything.
+//
+// Handlers should find the PlusResponseWriter with PlusWriter() rather than a type
+// assertion, as it may be wrapped by middleware.
+type PlusResponseWriter struct {
+	w     ResponseWriter
+	size  int64
+	began bool
+}
+
+var _ ResponseWriter = &PlusResponseWriter{}
+
+func NewPlusResponseWriter(w ResponseWriter) *PlusResponseWriter {
+	return &PlusResponseWriter{w: w, size: PlusSizeUntilClose}
+}
+
+// SetSize sets the size sent in the Gopher+ header. Size must be PlusSizeTerminated,
+// PlusSizeUntilClose or the exact number of bytes to be written. SetSize returns an
+// error if the header has already been sent.
+func (pw *PlusResponseWriter) SetSize(size int64) error {
+	if pw.began {
+		return errPlusAlreadyBegan
+	}
+	if size < PlusSizeUntilClose {
+		return errors.New("gopher: invalid gopher+ size")
+	}
+	pw.size = size
+	return nil
+}
+
+func (pw *PlusResponseWriter) Unwrap() ResponseWriter { return pw.w }
+
+// PlusWriter returns the PlusResponseWriter that w wraps, or nil if there isn't one,
+// i.e. the request was not a Gopher+ request.
+func PlusWriter(w ResponseWriter) *PlusResponseWriter {
+	var pw *PlusResponseWriter
+	unwrapResponseWriter(w, func(w interface{}) bool {
+		pw, _ = w.(*PlusResponseWriter)
+		return pw != nil
+	})
+	return pw
+}
+
+func (pw *PlusResponseWriter) begin() error {
+	pw.began = true
+	var buf = make([]byte, 0, 24)
+	buf = append(buf, '+')
+	buf = strconv.AppendInt(buf, pw.size, 10)
+	buf = append(buf, crlf...)
+	_, err := pw.w.Write(buf)
+	return err
+}
+
+func (pw *PlusResponseWriter) Write(b []byte) (n int, err error) {
+	if !pw.began {
+		if err := pw.begin(); err != nil {
+			return 0, err
+		}
+	}
+	return pw.w.Write(b)
+}
+
+// Flush sends the header if it has not already been sent. This is called by the Server
+// after the Handler returns, in case the Handler didn't write anything.
+func (pw *PlusResponseWriter) Flush() error {
+	if !pw.began {
+		return pw.begin()
+	}
+	return nil
+}
+
+// hintTerminated is used by writers that produce dot-terminated responses. The
+// PlusResponseWriter may be wrapped by middleware.
+func hintTerminated(w interface{}) {
+	unwrapResponseWriter(w, func(w interface{}) bool {
+		pw, ok := w.(*PlusResponseWriter)
+		if ok && !pw.began {
+			pw.size = PlusSizeTerminated
+		}
+		return ok
+	})
+}
+
+// suppressPlusHeader stops the Gopher+ header being sent, for responses that send
+// their own, i.e. errors. It must be called before anything is written.
+func suppressPlusHeader(w interface{}) {
+	unwrapResponseWriter(w, func(w interface{}) bool {
+		pw, ok := w.(*PlusResponseWriter)
+		if ok {
+			pw.began = true
+		}
+		return ok
+	})
+}
+
+// plusErrorCode converts a Status to one of the three Gopher+ error codes:
+//
+//	1  Item is not available.
+//	2  Try again later ("eg.  My load is too high right now.")
+//	3  Item has a new selector.
+func plusErrorCode(status Status) int {
+	switch status {
+	case StatusUnavailable, StatusRequestTimeout:
+		return 2
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,401 @@
+package gopher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol support, for servers behind load balancers like HAProxy:
+// https://www.haproxy.org/download/2.2/doc/proxy-protocol.txt
+
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+var (
+	ErrProxyHeaderInvalid = errors.New("gopher: proxy header invalid")
+
+	proxyV1Prefix  = []byte("PROXY ")
+	proxyV2Sig     = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	proxyV1MaxSize = 107
+	proxyV2MaxSize = 16 + 4096 // Big enough for all the TLVs we care about
+)
+
+type ProxyCommand int
+
+const (
+	ProxyCommandLocal ProxyCommand = 0 // Connection was made by the proxy itself, i.e. a health check
+	ProxyCommandProxy ProxyCommand = 1
+)
+
+// Well-known PROXY protocol v2 TLV types:
+const (
+	ProxyTLVALPN      byte = 0x01
+	ProxyTLVAuthority byte = 0x02 // Host name the client used, i.e. from TLS SNI
+	ProxyTLVCRC32C    byte = 0x03
+	ProxyTLVNoop      byte = 0x04
+	ProxyTLVUniqueID  byte = 0x05
+	ProxyTLVSSL       byte = 0x20
+	ProxyTLVNetNS     byte = 0x30
+)
+
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyHeader is the PROXY protocol header sent by a load balancer at the start of
+// a connection. Source and Destination are nil if the proxy did not send them (i.e.
+// 'PROXY UNKNOWN', or a v2 LOCAL command).
+type ProxyHeader struct {
+	Version     int
+	Command     ProxyCommand
+	Source      net.Addr
+	Destination net.Addr
+	TLVs        []ProxyTLV // v2 only
+}
+
+// TLV returns the value of the first TLV of type typ.
+func (ph *ProxyHeader) TLV(typ byte) (value []byte, ok bool) {
+	for _, tlv := range ph.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Authority returns the host name the client connected to, if the proxy sent it.
+func (ph *ProxyHeader) Authority() string {
+	v, _ := ph.TLV(ProxyTLVAuthority)
+	return string(v)
+}
+
+// ProxyListener wraps a Listener to read PROXY protocol v1 or v2 headers from
+// connections accepted from trusted upstreams. The RemoteAddr and LocalAddr of
+// connections returned by Accept will be those reported by the proxy.
+//
+// Headers are read in a goroutine per connection before Accept returns the connection,
+// so slow or malicious upstreams can not hold up the Server's accept loop, and
+// anything that inspects the RemoteAddr (MaxConnsPerIP, RateLimiter) sees the
+// client's real address.
+//
+// Connections from trusted upstreams that do not send a valid header are closed.
+// Connections from untrusted upstreams are accepted as-is; their header, if any,
+// is not parsed, so it will be treated as part of the request.
+type ProxyListener struct {
+	Listener net.Listener
+
+	// Upstreams allowed to send PROXY headers. If empty, no upstreams are trusted and
+	// no headers are parsed. Trusting '0.0.0.0/0' and '::/0' is only safe if nothing
+	// but the proxy can reach the listener, as any client could claim any address.
+	Trusted []*net.IPNet
+
+	// Maximum time to wait for a trusted upstream to send the header. If zero,
+	// DefaultProxyHeaderTimeout is used.
+	HeaderTimeout time.Duration
+
+	once    sync.Once
+	results chan proxyAcceptResult
+	done    chan struct{}
+	err     error
+}
+
+var _ net.Listener = &ProxyListener{}
+
+type proxyAcceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+func (pl *ProxyListener) Addr() net.Addr { return pl.Listener.Addr() }
+
+func (pl *ProxyListener) Close() error { return pl.Listener.Close() }
+
+func (pl *ProxyListener) Accept() (net.Conn, error) {
+	pl.once.Do(pl.start)
+	select {
+	case r := <-pl.results:
+		return r.conn, r.err
+	case <-pl.done:
+		return nil, pl.err
+	}
+}
+
+func (pl *ProxyListener) start() {
+	pl.results = make(chan proxyAcceptResult)
+	pl.done = make(chan struct{})
+	go pl.acceptLoop()
+}
+
+func (pl *ProxyListener) acceptLoop() {
+	for {
+		conn, err := pl.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				select {
+				case pl.results <- proxyAcceptResult{err: err}:
+					continue
+				case <-pl.done:
+					return
+				}
+			}
+			pl.err = err
+			close(pl.done)
+			return
+		}
+		go pl.handshake(conn)
+	}
+}
+
+func (pl *ProxyListener) handshake(conn net.Conn) {
+	if pl.isTrusted(conn.RemoteAddr()) {
+		pc, err := pl.readHeader(conn)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		conn = pc
+	}
+
+	select {
+	case pl.results <- proxyAcceptResult{conn: conn}:
+	case <-pl.done:
+		conn.Close()
+	}
+}
+
+func (pl *ProxyListener) isTrusted(addr net.Addr) bool {
+	ip := net.ParseIP(addrIP(addr))
+	if ip == nil {
+		return false
+	}
+	for _, n := range pl.Trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (pl *ProxyListener) headerTimeout() time.Duration {
+	if pl.HeaderTimeout > 0 {
+		return pl.HeaderTimeout
+	}
+	return DefaultProxyHeaderTimeout
+}
+
+func (pl *ProxyListener) readHeader(conn net.Conn) (*proxyConn, error) {
+	conn.SetReadDeadline(time.Now().Add(pl.headerTimeout()))
+	defer conn.SetReadDeadline(time.Time{})
+
+	// The reader must not consume anything past the end of the header unless it is
+	// returned by proxyConn.Read, otherwise we'd break the TLS sniffing in the Server:
+	br := bufio.NewReaderSize(conn, 256)
+	hdr, err := readProxyHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, br: br, header: hdr}, nil
+}
+
+// proxyConn is a connection that has had its PROXY header consumed.
+type proxyConn struct {
+	net.Conn
+	br     *bufio.Reader
+	header *ProxyHeader
+}
+
+func (pc *proxyConn) Read(b []byte) (n int, err error) {
+	if pc.br != nil {
+		if pc.br.Buffered() > 0 {
+			return pc.br.Read(b)
+		}
+		pc.br = nil
+	}
+	return pc.Conn.Read(b)
+}
+
+func (pc *proxyConn) RemoteAddr() net.Addr {
+	if pc.header.Source != nil {
+		return pc.header.Source
+	}
+	return pc.Conn.RemoteAddr()
+}
+
+func (pc *proxyConn) LocalAddr() net.Addr {
+	if pc.header.Destination != nil {
+		return pc.header.Destination
+	}
+	return pc.Conn.LocalAddr()
+}
+
+// connProxyHeader returns the PROXY header read from conn, or nil.
+func connProxyHeader(conn net.Conn) *ProxyHeader {
+	if pc, ok := conn.(*proxyConn); ok {
+		return pc.header
+	}
+	return nil
+}
+
+func readProxyHeader(br *bufio.Reader) (*ProxyHeader, error) {
+	sig, err := br.Peek(len(proxyV2Sig))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(sig, proxyV2Sig) {
+		return readProxyV2(br)
+	} else if bytes.HasPrefix(sig, proxyV1Prefix) {
+		return readProxyV1(br)
+	}
+	return nil, fmt.Errorf("%w: signature not found", ErrProxyHeaderInvalid)
+}
+
+func readProxyV1(br *bufio.Reader) (*ProxyHeader, error) {
+	// Avoid ReadString so we never read more than the maximum header size:
+	var line = make([]byte, 0, proxyV1MaxSize)
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxSize {
+			return nil, fmt.Errorf("%w: v1 header too long", ErrProxyHeaderInvalid)
+		}
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: v1 header not terminated by CRLF", ErrProxyHeaderInvalid)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	hdr := &ProxyHeader{Version: 1, Command: ProxyCommandProxy}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return hdr, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("%w: v1 header has %d fields", ErrProxyHeaderInvalid, len(fields))
+	}
+
+	var want4 bool
+	switch fields[1] {
+	case "TCP4":
+		want4 = true
+	case "TCP6":
+	default:
+		return nil, fmt.Errorf("%w: v1 protocol %q unknown", ErrProxyHeaderInvalid, fields[1])
+	}
+
+	src, err := parseProxyV1Addr(fields[2], fields[4], want4)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseProxyV1Addr(fields[3], fields[5], want4)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Source, hdr.Destination = src, dst
+	return hdr, nil
+}
+
+func parseProxyV1Addr(ipStr, portStr string, want4 bool) (*net.TCPAddr, error) {
+	ip := net.ParseIP(ipStr)
+	if ip == nil || (ip.To4() != nil) != want4 {
+		return nil, fmt.Errorf("%w: v1 address %q invalid", ErrProxyHeaderInvalid, ipStr)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: v1 port %q invalid", ErrProxyHeaderInvalid, portStr)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyV2(br *bufio.Reader) (*ProxyHeader, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(br, fixed[:]); err != nil {
+		return nil, err
+	}
+
+	verCmd, fam := fixed[12], fixed[13]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: v2 version %d unknown", ErrProxyHeaderInvalid, verCmd>>4)
+	}
+	size := int(binary.BigEndian.Uint16(fixed[14:]))
+	if size > proxyV2MaxSize-16 {
+		return nil, fmt.Errorf("%w: v2 header too long", ErrProxyHeaderInvalid)
+	}
+
+	var body = make([]byte, size)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, err
+	}
+
+	hdr := &ProxyHeader{Version: 2, Command: ProxyCommand(verCmd & 0xf)}
+	switch hdr.Command {
+	case ProxyCommandLocal:
+		// Addresses must be ignored for LOCAL, but TLVs may still be present.
+	case ProxyCommandProxy:
+	default:
+		return nil, fmt.Errorf("%w: v2 command %d unknown", ErrProxyHeaderInvalid, hdr.Command)
+	}
+
+	var addrLen int
+	switch fam >> 4 {
+	case 0x0: // AF_UNSPEC
+	case 0x1: // AF_INET
+		addrLen = 12
+	case 0x2: // AF_INET6
+		addrLen = 36
+	case 0x3: // AF_UNIX
+		addrLen = 216
+	default:
+		return nil, fmt.Errorf("%w: v2 address family %d unknown", ErrProxyHeaderInvalid, fam>>4)
+	}
+	if len(body) < addrLen {
+		return nil, fmt.Errorf("%w: v2 address truncated", ErrProxyHeaderInvalid)
+	}
+
+	if hdr.Command == ProxyCommandProxy {
+		// Only TCP over IPv4 or IPv6 is of any interest to us; for anything else we
+		// leave the addresses alone:
+		transport := fam & 0xf
+		if transport == 0x1 && (addrLen == 12 || addrLen == 36) {
+			ipLen := (addrLen - 4) / 2
+			hdr.Source = &net.TCPAddr{
+				IP:   net.IP(append([]byte(nil), body[:ipLen]...)),
+				Port: int(binary.BigEndian.Uint16(body[ipLen*2:])),
+			}
+			hdr.Destination = &net.TCPAddr{
+				IP:   net.IP(append([]byte(nil), body[ipLen:ipLen*2]...)),
+				Port: int(binary.BigEndian.Uint16(body[ipLen*2+2:])),
+			}
+		}
+	}
+
+	tlvs := body[addrLen:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, fmt.Errorf("%w: v2 TLV truncated", ErrProxyHeaderInvalid)
+		}
+		typ, vlen := tlvs[0], int(binary.BigEndian.Uint16(tlvs[1:]))
+		if len(tlvs) < 3+vlen {
+			return nil, fmt.Errorf("%w: v2 TLV truncated", ErrProxyHeaderInvalid)
+		}
+		if typ != ProxyTLVNoop {
+			hdr.TLVs = append(hdr.TLVs, ProxyTLV{Type: typ, Value: tlvs[3 : 3+vlen]})
+		}
+		tlvs = tlvs[3+vlen:]
+	}
+
+	return hdr, nil
+}
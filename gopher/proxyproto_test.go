@@ -0,0 +1,186 @@
+package gopher
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadProxyHeaderV1(t *testing.T) {
+	for idx, tc := range []struct {
+		in       string
+		src, dst string
+	}{
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324 70\r\n", "192.168.0.1:56324", "192.168.0.11:70"},
+		{"PROXY TCP6 ::1 2001:db8::1 1 2\r\n", "[::1]:1", "[2001:db8::1]:2"},
+		{"PROXY UNKNOWN\r\n", "", ""},
+		{"PROXY UNKNOWN ::1 ::1 1 2\r\n", "", ""},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			// The header must not consume the 0x16 that follows, or TLS sniffing breaks:
+			br := bufio.NewReader(strings.NewReader(tc.in + "\x16rest"))
+			hdr, err := readProxyHeader(br)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Version != 1 || hdr.Command != ProxyCommandProxy {
+				t.Fatal(hdr)
+			}
+			if tc.src == "" {
+				if hdr.Source != nil || hdr.Destination != nil {
+					t.Fatal(hdr)
+				}
+			} else if hdr.Source.String() != tc.src || hdr.Destination.String() != tc.dst {
+				t.Fatal(hdr.Source, hdr.Destination)
+			}
+			rest, _ := ioutil.ReadAll(br)
+			if string(rest) != "\x16rest" {
+				t.Fatalf("%q", rest)
+			}
+		})
+	}
+}
+
+func TestReadProxyHeaderV1Invalid(t *testing.T) {
+	for idx, tc := range []string{
+		"PROXY TCP4 192.168.0.1 192.168.0.11 56324 70\n",
+		"PROXY TCP4 ::1 192.168.0.11 56324 70\r\n",
+		"PROXY TCP6 192.168.0.1 ::1 56324 70\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 56324 70000\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 56324\r\n",
+		"PROXY UDP4 192.168.0.1 192.168.0.11 56324 70\r\n",
+		"PROXY " + strings.Repeat("x", 200) + "\r\n",
+		"GET / HTTP/1.0\r\n\r\n",
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			_, err := readProxyHeader(bufio.NewReader(strings.NewReader(tc)))
+			if !errors.Is(err, ErrProxyHeaderInvalid) {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func buildProxyV2(cmd byte, fam byte, addrs []byte, tlvs ...ProxyTLV) []byte {
+	var body = append([]byte(nil), addrs...)
+	for _, tlv := range tlvs {
+		body = append(body, tlv.Type, 0, 0)
+		binary.BigEndian.PutUint16(body[len(body)-2:], uint16(len(tlv.Value)))
+		body = append(body, tlv.Value...)
+	}
+	out := append([]byte(nil), proxyV2Sig...)
+	out = append(out, 0x20|cmd, fam, 0, 0)
+	binary.BigEndian.PutUint16(out[len(out)-2:], uint16(len(body)))
+	return append(out, body...)
+}
+
+func TestReadProxyHeaderV2(t *testing.T) {
+	addrs := []byte{
+		10, 0, 0, 1, // src
+		10, 0, 0, 2, // dst
+		0x1f, 0x90, // src port 8080
+		0, 70, // dst port
+	}
+	raw := buildProxyV2(1, 0x11, addrs,
+		ProxyTLV{Type: ProxyTLVAuthority, Value: []byte("gopher.example.com")},
+		ProxyTLV{Type: ProxyTLVNoop, Value: []byte("xx")},
+		ProxyTLV{Type: ProxyTLVUniqueID, Value: []byte("id")})
+
+	br := bufio.NewReader(strings.NewReader(string(raw) + "\x16"))
+	hdr, err := readProxyHeader(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Version != 2 || hdr.Command != ProxyCommandProxy {
+		t.Fatal(hdr)
+	}
+	if hdr.Source.String() != "10.0.0.1:8080" || hdr.Destination.String() != "10.0.0.2:70" {
+		t.Fatal(hdr.Source, hdr.Destination)
+	}
+	if hdr.Authority() != "gopher.example.com" || len(hdr.TLVs) != 2 {
+		t.Fatal(hdr.TLVs)
+	}
+	if id, ok := hdr.TLV(ProxyTLVUniqueID); !ok || string(id) != "id" {
+		t.Fatal(id)
+	}
+	if rest, _ := ioutil.ReadAll(br); string(rest) != "\x16" {
+		t.Fatalf("%q", rest)
+	}
+
+	// LOCAL commands must ignore the addresses:
+	hdr, err = readProxyHeader(bufio.NewReader(strings.NewReader(string(buildProxyV2(0, 0x11, addrs)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Command != ProxyCommandLocal || hdr.Source != nil {
+		t.Fatal(hdr)
+	}
+
+	// Truncated TLV:
+	raw = buildProxyV2(1, 0x11, append(addrs, ProxyTLVAuthority, 0, 10, 'x'))
+	if _, err := readProxyHeader(bufio.NewReader(strings.NewReader(string(raw)))); !errors.Is(err, ErrProxyHeaderInvalid) {
+		t.Fatal(err)
+	}
+}
+
+func TestServerProxyListener(t *testing.T) {
+	for idx, tc := range []struct {
+		trusted string
+		rq      string
+		out     string
+	}{
+		{"127.0.0.0/8", "PROXY TCP4 192.0.2.1 192.0.2.2 1234 70\r\n/\r\n", "192.0.2.1:1234 / "},
+		{"127.0.0.0/8", string(buildProxyV2(1, 0x11, []byte{192, 0, 2, 1, 192, 0, 2, 2, 0, 1, 0, 70},
+			ProxyTLV{Type: ProxyTLVAuthority, Value: []byte("example.com")})) + "/foo\r\n",
+			"192.0.2.1:1 /foo example.com"},
+
+		// Untrusted upstreams don't get their headers parsed:
+		{"10.0.0.0/8", "PROXY TCP4 192.0.2.1 192.0.2.2 1234 70\r\n/\r\n", "127.0.0.1 PROXY TCP4 192.0.2.1 192.0.2.2 1234 70 "},
+
+		// Nobody is trusted if Trusted is empty:
+		{"", "PROXY TCP4 192.0.2.1 192.0.2.2 1234 70\r\n/\r\n", "127.0.0.1 PROXY TCP4 192.0.2.1 192.0.2.2 1234 70 "},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			pl := &ProxyListener{}
+			if tc.trusted != "" {
+				_, n, err := net.ParseCIDR(tc.trusted)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pl.Trusted = []*net.IPNet{n}
+			}
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pl.Listener = ln
+
+			srv := &Server{ErrorLog: nilLogger}
+			srv.Handler = HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+				addr := r.RemoteAddr.String()
+				if r.Proxy == nil {
+					addr = r.RemoteAddr.IP.String()
+				}
+				var authority string
+				if r.Proxy != nil {
+					authority = r.Proxy.Authority()
+				}
+				fmt.Fprintf(w, "%s %s %s", addr, r.URL().Selector, authority)
+			})
+			go srv.Serve(pl, "localhost:70")
+			defer srv.Close()
+
+			out := testRawRequest(t, ln.Addr().String(), tc.rq)
+			if out != tc.out {
+				t.Fatalf("%q", out)
+			}
+		})
+	}
+}
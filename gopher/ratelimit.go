@@ -0,0 +1,134 @@
+package gopher
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// RateLimiter decides whether to accept a connection from a remote address. Allow is
+// called from the Server's accept loop, so it must be safe for concurrent use and must
+// not block.
+type RateLimiter interface {
+	Allow(remote net.Addr) bool
+}
+
+type RateLimiterFunc func(remote net.Addr) bool
+
+func (fn RateLimiterFunc) Allow(remote net.Addr) bool { return fn(remote) }
+
+// IPRateLimiter is a token bucket RateLimiter keyed by the IP address of the remote
+// address. Each IP can make 'burst' requests immediately, after which its bucket
+// refills at 'rate' requests per second.
+//
+// Addresses without an IP (i.e. unix sockets) are not limited.
+type IPRateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+var _ RateLimiter = &IPRateLimiter{}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// How often we clean up buckets that have refilled completely and can be forgotten:
+const rateLimitPruneInterval = time.Minute
+
+func NewIPRateLimiter(rate float64, burst int) *IPRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &IPRateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+func (rl *IPRateLimiter) Allow(remote net.Addr) bool {
+	ip := addrIP(remote)
+	if ip == "" {
+		return true
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	if now.Sub(rl.lastPrune) >= rateLimitPruneInterval {
+		rl.prune(now)
+	}
+
+	b := rl.buckets[ip]
+	if b == nil {
+		b = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[ip] = b
+	} else {
+		rl.refill(b, now)
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (rl *IPRateLimiter) refill(b *tokenBucket, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * rl.rate
+		if b.tokens > rl.burst {
+			b.tokens = rl.burst
+		}
+	}
+	b.last = now
+}
+
+func (rl *IPRateLimiter) prune(now time.Time) {
+	rl.lastPrune = now
+	for ip, b := range rl.buckets {
+		rl.refill(b, now)
+		if b.tokens >= rl.burst {
+			delete(rl.buckets, ip)
+		}
+	}
+}
+
+// addrIP returns the IP of an address as a string suitable for use as a map key, or an
+// empty string if the address does not have an IP.
+func addrIP(addr net.Addr) string {
+	var ip net.IP
+	switch addr := addr.(type) {
+	case nil:
+		return ""
+	case *net.TCPAddr:
+		if addr != nil {
+			ip = addr.IP
+		}
+	case *net.UDPAddr:
+		if addr != nil {
+			ip = addr.IP
+		}
+	case *net.IPAddr:
+		if addr != nil {
+			ip = addr.IP
+		}
+	default:
+		if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+			ip = net.ParseIP(host)
+		}
+	}
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,129 @@
+package gopher
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIPRateLimiter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl := NewIPRateLimiter(2, 3)
+	rl.now = func() time.Time { return now }
+
+	a := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1000}
+	b := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 1000}
+	aOtherPort := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2000}
+
+	for i := 0; i < 3; i++ {
+		if !rl.Allow(a) {
+			t.Fatal(i)
+		}
+	}
+	if rl.Allow(aOtherPort) {
+		t.Fatal()
+	}
+	if !rl.Allow(b) {
+		t.Fatal()
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !rl.Allow(a) {
+		t.Fatal()
+	}
+	if rl.Allow(a) {
+		t.Fatal()
+	}
+
+	// Everything should have refilled by the time we prune, so all buckets go:
+	now = now.Add(rateLimitPruneInterval)
+	if !rl.Allow(a) {
+		t.Fatal()
+	}
+	if len(rl.buckets) != 1 {
+		t.Fatal(len(rl.buckets))
+	}
+
+	if !rl.Allow(&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}) {
+		t.Fatal()
+	}
+}
+
+func testBlockingServer(t *testing.T, srv *Server) (addr string, entered <-chan struct{}, release func()) {
+	t.Helper()
+	var enteredC = make(chan struct{}, 10)
+	var releaseC = make(chan struct{})
+	mux := NewMux()
+	mux.Handle("/block.txt", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		enteredC <- struct{}{}
+		<-releaseC
+		w.Write([]byte("done"))
+	}), nil)
+	mux.Handle("/fast.txt", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Write([]byte("fast"))
+	}), nil)
+	srv.Handler = mux
+	return testServe(t, srv), enteredC, func() { close(releaseC) }
+}
+
+func TestServerMaxConns(t *testing.T) {
+	addr, entered, release := testBlockingServer(t, &Server{MaxConns: 1})
+
+	var done = make(chan string)
+	go func() { done <- testRawRequest(t, addr, "/block.txt\r\n") }()
+	<-entered
+
+	out := testRawRequest(t, addr, "/fast.txt\r\n")
+	if out != "Error: 503, server busy, try again later\r\n.\r\n" {
+		t.Fatalf("%q", out)
+	}
+	out = testRawRequest(t, addr, "/fast.txt\t\t0\r\n")
+	if out != "--503\r\nserver busy, try again later\r\n.\r\n" {
+		t.Fatalf("%q", out)
+	}
+
+	release()
+	if out := <-done; out != "done" {
+		t.Fatal(out)
+	}
+
+	// The slot should be released once the first connection is done:
+	if out := testRawRequest(t, addr, "/fast.txt\r\n"); out != "fast" {
+		t.Fatal(out)
+	}
+}
+
+func TestServerMaxConnsPerIP(t *testing.T) {
+	addr, entered, release := testBlockingServer(t, &Server{MaxConnsPerIP: 1})
+
+	var done = make(chan string)
+	go func() { done <- testRawRequest(t, addr, "/block.txt\r\n") }()
+	<-entered
+
+	out := testRawRequest(t, addr, "/fast.txt\t+\r\n")
+	if out != "--1\r\n2 Error: 503, too many connections, try again later\r\n.\r\n" {
+		t.Fatalf("%q", out)
+	}
+
+	release()
+	<-done
+	if out := testRawRequest(t, addr, "/fast.txt\r\n"); out != "fast" {
+		t.Fatal(out)
+	}
+}
+
+func TestServerRateLimiter(t *testing.T) {
+	addr, _, release := testBlockingServer(t, &Server{RateLimiter: NewIPRateLimiter(0.0001, 2)})
+	defer release()
+
+	for i := 0; i < 2; i++ {
+		if out := testRawRequest(t, addr, "/fast.txt\r\n"); out != "fast" {
+			t.Fatal(out)
+		}
+	}
+	out := testRawRequest(t, addr, "/fast.txt\r\n")
+	if out != "Error: 503, too many requests, try again later\r\n.\r\n" {
+		t.Fatalf("%q", out)
+	}
+}
@@ -2,24 +2,44 @@ package gopher
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
+	"strconv"
+	"time"
 )
 
 type Request struct {
-	url    URL
-	body   io.ReadCloser
-	format string
+	url     URL
+	body    io.ReadCloser
+	format  string
+	view    string
+	dialect Dialect
+
+	errRenderer ErrorRenderer
+	log         Logger
+	mux         *Mux
 
 	// Server only. When a server accepts an actual connection, this will be set to the
-	// remote address.  This field is ignored by the Gopher client.
+	// remote address.  This field is ignored by the Gopher client. This will be nil if
+	// the connection is not TCP, i.e. Unix sockets, or inetd over a pipe.
 	RemoteAddr *net.TCPAddr
 
+	// Server only. TLS is set if the request was received over a TLS connection.
+	TLS *tls.ConnectionState
+
+	// Server only. Proxy is set if the connection was accepted by a ProxyListener and
+	// the upstream sent a PROXY header.
+	Proxy *ProxyHeader
+
 	// Server only. Params is free to be set by your Server's Mux implementation. If you
 	// have requirements that this can't satisfy, use the dreaded context.WithValue() to
 	// add what you need.
+	//
+	// Mux reuses Params between requests, so they are only valid until the Handler
+	// returns. Use Params.Copy() to keep them for longer.
 	Params Params
 
 	// Server only. SelectorPrefix is added to all generated selectors which are internal
@@ -54,6 +74,19 @@ func NewFormatRequest(url URL, format string, body io.Reader) (*Request, error)
 	return rq, nil
 }
 
+// Selector builds a selector for a named route in the Mux that is serving the Request,
+// including the SelectorPrefix. See Mux.Selector() for a description of params.
+func (r *Request) Selector(name string, params ...string) (string, error) {
+	if r.mux == nil {
+		return "", fmt.Errorf("gopher: request was not served by a Mux")
+	}
+	sel, err := r.mux.Selector(name, params...)
+	if err != nil {
+		return "", err
+	}
+	return r.SelectorPrefix + sel, nil
+}
+
 func (r *Request) URL() URL            { return r.url }
 func (r *Request) Body() io.ReadCloser { return r.body }
 
@@ -67,6 +100,40 @@ func (r *Request) Format() string {
 	return r.format
 }
 
+// Dialect reports the flavour of the Gopher protocol used by the client to make the
+// request. This is only set for requests received by a Server.
+func (r *Request) Dialect() Dialect {
+	return r.dialect
+}
+
+// PlusView returns the name of the view requested by a Gopher+ client, i.e.
+// 'text/plain'. If the client did not ask for a specific view, PlusView returns an empty
+// string, as it does for requests from other dialects.
+func (r *Request) PlusView() string {
+	return r.view
+}
+
+func (r *Request) errorRenderer() ErrorRenderer {
+	if r.errRenderer != nil {
+		return r.errRenderer
+	}
+	return DefaultErrorRenderer
+}
+
+func (r *Request) logger() Logger {
+	if r.log != nil {
+		return r.log
+	}
+	return stdLogger
+}
+
+func (r *Request) remoteAddrString() string {
+	if r.RemoteAddr == nil {
+		return "<unknown>"
+	}
+	return r.RemoteAddr.String()
+}
+
 func (r *Request) buildSelector(buf *bytes.Buffer) error {
 	buf.WriteString(r.url.Selector)
 
@@ -101,6 +168,14 @@ type Param struct {
 	Key, Value string
 }
 
+// Copy returns a copy of params that can be kept after the Handler returns.
+func (params Params) Copy() Params {
+	if params == nil {
+		return nil
+	}
+	return append(make(Params, 0, len(params)), params...)
+}
+
 func (params Params) Get(name string) string {
 	for _, param := range params {
 		if param.Key == name {
@@ -109,3 +184,61 @@ func (params Params) Get(name string) string {
 	}
 	return ""
 }
+
+// Int parses the param called name as a base 10 int.
+func (params Params) Int(name string) (int, error) {
+	v, err := params.Int64(name)
+	return int(v), err
+}
+
+// Int64 parses the param called name as a base 10 int64.
+func (params Params) Int64(name string) (int64, error) {
+	value, ok := params.lookup(name)
+	if !ok {
+		return 0, fmt.Errorf("gopher: param %q not found", name)
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("gopher: param %q is not an int: %w", name, err)
+	}
+	return v, nil
+}
+
+// Uint64 parses the param called name as a base 10 uint64.
+func (params Params) Uint64(name string) (uint64, error) {
+	value, ok := params.lookup(name)
+	if !ok {
+		return 0, fmt.Errorf("gopher: param %q not found", name)
+	}
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("gopher: param %q is not a uint: %w", name, err)
+	}
+	return v, nil
+}
+
+// Time parses the param called name using layout. If layout is empty,
+// ParamDateLayout is used, which matches the 'date' Mux constraint.
+func (params Params) Time(name string, layout string) (time.Time, error) {
+	value, ok := params.lookup(name)
+	if !ok {
+		return time.Time{}, fmt.Errorf("gopher: param %q not found", name)
+	}
+	if layout == "" {
+		layout = ParamDateLayout
+	}
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("gopher: param %q is not a time: %w", name, err)
+	}
+	return t, nil
+}
+
+func (params Params) lookup(name string) (value string, ok bool) {
+	for _, param := range params {
+		if param.Key == name {
+			return param.Value, true
+		}
+	}
+	return "", false
+}
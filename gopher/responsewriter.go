@@ -14,9 +14,9 @@ type ResponseWriter interface {
 }
 
 func NotFound(w ResponseWriter, r *Request) {
-	dw := NewDirWriter(w, r)
-	defer MustFlush(dw)
-	dw.Error(fmt.Sprintf("Not found: %s", r.URL()))
+	if err := RespondError(w, r, StatusNotFound, fmt.Sprintf("Not found: %s", r.URL())); err != nil {
+		panic(err)
+	}
 }
 
 type TextWriter struct {
@@ -26,6 +26,8 @@ type TextWriter struct {
 }
 
 func NewTextWriter(w io.Writer) *TextWriter {
+	hintTerminated(w)
+	hintItemType(w, Text)
 	return &TextWriter{
 		bufw: bufio.NewWriter(w),
 	}
@@ -87,10 +89,13 @@ type DirWriter struct {
 	host string
 	port string
 	base string
+	mux  *Mux
 	err  error
 }
 
 func NewDirWriter(w io.Writer, rq *Request) *DirWriter {
+	hintTerminated(w)
+	hintItemType(w, Dir)
 	return NewDirWriterBuffer(bufio.NewWriter(w), rq)
 }
 
@@ -105,6 +110,7 @@ func NewDirWriterBuffer(w *bufio.Writer, rq *Request) *DirWriter {
 		host: u.Hostname,
 		port: strconv.FormatInt(int64(port), 10),
 		base: rq.SelectorPrefix,
+		mux:  rq.mux,
 	}
 }
 
@@ -173,6 +179,19 @@ func (dw *DirWriter) WWW(disp, url string) error {
 	return dw.Selector(Dir, disp, "URL:"+url)
 }
 
+// Route writes a dirent for a named route in the Mux that is serving the Request. See
+// Mux.Selector() for a description of params.
+func (dw *DirWriter) Route(i ItemType, disp, name string, params ...string) error {
+	if dw.mux == nil {
+		return dw.check(fmt.Errorf("gopher: dirent route %q failed: request was not served by a Mux", name))
+	}
+	sel, err := dw.mux.Selector(name, params...)
+	if err != nil {
+		return dw.check(err)
+	}
+	return dw.Selector(i, disp, sel)
+}
+
 func (dw *DirWriter) Binary(disp, sel string) error {
 	return dw.Selector(Binary, disp, sel)
 }
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,15 +19,28 @@ const (
 	DefaultRequestSizeLimit    = 1 << 12
 	DefaultReadTimeout         = 10 * time.Second
 	DefaultReadSelectorTimeout = 5 * time.Second
+
+	// Connections rejected by MaxConns, MaxConnsPerIP or RateLimiter must read the
+	// request and send the error within this time:
+	rejectTimeout = 2 * time.Second
+
+	// Maximum number of rejected connections we will send a busy error to at once.
+	// Beyond this, connections are closed without a response.
+	maxRejectingConns = 256
 )
 
 var (
 	ErrBadRequest   = errors.New("gopher: bad request")
 	ErrServerClosed = errors.New("gopher: server closed")
 
+	errHostRequired = errors.New("gopher: host required for non-TCP listeners")
+
 	errRequestFileFlagInvalid = errors.New("client sent an invalid file flag") // gIIs6
-	errRequestTrailingData    = errors.New("request contained invalid trailing data")
 	errRequestTooLarge        = errors.New("request selector string size exceeded limit")
+
+	errServerBusy   = errors.New("server busy, try again later")
+	errTooManyConns = errors.New("too many connections, try again later")
+	errRateLimited  = errors.New("too many requests, try again later")
 )
 
 var (
@@ -43,6 +58,26 @@ type Server struct {
 	ErrorLog    Logger
 	Info        *ServerInfo
 
+	// If set, AccessLog receives an entry for every request the Server reads, including
+	// those rejected before they reach the Handler. See also Metrics.
+	AccessLog AccessLogger
+
+	// If set, connections that start with an HTTP/1.x request line (i.e. 'GET /
+	// HTTP/1.1') are handed to HTTPHandler, so a browser pointed at the gopher port
+	// gets something useful. See HTMLGateway. If nil, HTTP requests are treated as
+	// gopher selectors, as they are by most gopher servers.
+	HTTPHandler http.Handler
+
+	// If set, ConnState is called when a connection changes state. The conn is always
+	// the connection returned by the Listener, even after a TLS upgrade. ConnState is
+	// called from the connection's goroutine, except for StateNew which is called
+	// from the accept loop, so it must not block.
+	ConnState func(conn net.Conn, state ConnState)
+
+	// ErrorRenderer is used to send all errors to clients, including those generated
+	// by Handlers using RespondError(). If nil, DefaultErrorRenderer is used.
+	ErrorRenderer ErrorRenderer
+
 	// If false, the server will not intercept request for caps.txt
 	DisableCaps bool
 
@@ -53,13 +88,48 @@ type Server struct {
 	ReadSelectorTimeout time.Duration
 	TLSConfig           *tls.Config
 
+	// Maximum duration for writing the response, starting after the request is read.
+	// If zero, there is no limit.
+	WriteTimeout time.Duration
+
+	// Maximum duration a single write may block. Writes are sent in chunks of 16KiB, so
+	// this protects against clients that stop reading or read extremely slowly; a
+	// client must read at least 16KiB every WriteIdleTimeout. If zero, there is no
+	// limit.
+	WriteIdleTimeout time.Duration
+
+	// Maximum number of bytes per second written to each connection. If zero, there is
+	// no limit.
+	WriteRateLimit int
+
+	// Maximum number of connections the Server will serve at once. Connections beyond
+	// the limit receive a StatusUnavailable error. If zero, there is no limit.
+	MaxConns int
+
+	// Maximum number of connections from a single IP address the Server will serve at
+	// once. Connections beyond the limit receive a StatusUnavailable error. If zero,
+	// there is no limit.
+	MaxConnsPerIP int
+
+	// If set, connections are only served if RateLimiter allows them; the rest receive
+	// a StatusUnavailable error. See IPRateLimiter.
+	RateLimiter RateLimiter
+
 	// This will be set in the Request so that writers like DirWriter can build prefixed
 	// selectors with zero extra config.
 	SelectorPrefix string
 
-	conns     map[net.Conn]struct{}
-	listeners map[net.Listener]struct{}
-	lock      sync.Mutex
+	conns      map[net.Conn]connInfo
+	connsPerIP map[string]int
+	active     int
+	rejecting  int
+	listeners  map[net.Listener]struct{}
+	lock       sync.Mutex
+}
+
+type connInfo struct {
+	ip     string
+	reject error
 }
 
 func (srv *Server) ListenAndServe(addr string, host string) error {
@@ -73,6 +143,22 @@ func (srv *Server) ListenAndServe(addr string, host string) error {
 	return srv.Serve(ln, host)
 }
 
+// ListenAndServeUnix listens on a Unix domain socket at path. Host must be set, as
+// there's no way to work out how clients reach the server from a socket path.
+//
+// Requests received over Unix sockets have a nil RemoteAddr, unless the Server is
+// behind a proxy that sends PROXY headers (see ProxyListener).
+func (srv *Server) ListenAndServeUnix(path string, host string) error {
+	if host == "" {
+		return errHostRequired
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(ln, host)
+}
+
 func (srv *Server) Close() error {
 	srv.lock.Lock()
 	defer srv.lock.Unlock()
@@ -98,7 +184,17 @@ func (srv *Server) metaHandler() MetaHandler {
 	return nil
 }
 
+// Serve accepts connections from l until l returns a permanent error. Host is the
+// host:port clients should use to reach the server, which is used to build selectors
+// for the server's own items. If host is empty, the listener's address is used, which
+// is only possible for TCP listeners.
 func (srv *Server) Serve(l net.Listener, host string) error {
+	if host == "" {
+		if _, ok := l.Addr().(*net.TCPAddr); !ok {
+			return errHostRequired
+		}
+	}
+
 	srv.addListener(l)
 
 	var lhost, lport string
@@ -111,10 +207,7 @@ func (srv *Server) Serve(l net.Listener, host string) error {
 	}
 
 	var metaHandler = srv.metaHandler()
-	var log = srv.ErrorLog
-	if log == nil {
-		log = stdLogger
-	}
+	var log = srv.logger()
 
 	var tempDelay time.Duration // http.Server trick for dealing with accept failure
 
@@ -140,28 +233,77 @@ func (srv *Server) Serve(l net.Listener, host string) error {
 		}
 
 		tempDelay = 0
-		chost, cport := lhost, lport
-		if chost == "" {
-			chost, cport, err = resolveHostPort(conn.LocalAddr().String())
-			if err != nil {
-				return err
-			}
+		c, err := srv.newConn(conn, lhost, lport, log, metaHandler)
+		if err != nil {
+			return err
+		}
+		if c.reject = srv.addConn(conn); c.reject != nil && srv.isRejectingTooMany() {
+			// We're already sending too many busy errors, so this one just gets dropped:
+			srv.removeConn(conn)
+			conn.Close()
+			continue
 		}
 
+		c.setState(StateNew)
 		ctx := context.Background()
-		buf := make([]byte, srv.requestSizeLimit())
-		c := &serveConn{
-			rwc: conn, srv: srv, buf: buf,
-			host: chost, port: cport,
-			log: log, meta: metaHandler,
-		}
-		srv.addConn(conn)
 		go c.serve(ctx)
 	}
+}
+
+// ServeConn serves a single connection, returning once the response has been sent. This
+// can be used to run a Server from inetd or xinetd; see InetdConn().
+//
+// Host is the host:port clients should use to reach the server. If host is empty, the
+// connection's local address is used, which is only possible for TCP connections.
+//
+// MaxConns, MaxConnsPerIP and RateLimiter are applied as they are by Serve.
+func (srv *Server) ServeConn(conn net.Conn, host string) error {
+	var lhost, lport string
+	if host != "" {
+		var err error
+		lhost, lport, err = resolveHostPort(host)
+		if err != nil {
+			return err
+		}
+	} else if _, ok := conn.LocalAddr().(*net.TCPAddr); !ok {
+		return errHostRequired
+	}
 
+	c, err := srv.newConn(conn, lhost, lport, srv.logger(), srv.metaHandler())
+	if err != nil {
+		return err
+	}
+	c.reject = srv.addConn(conn)
+	c.setState(StateNew)
+	c.serve(context.Background())
 	return nil
 }
 
+func (srv *Server) newConn(conn net.Conn, host, port string, log Logger, meta MetaHandler) (*serveConn, error) {
+	if host == "" {
+		var err error
+		host, port, err = resolveHostPort(conn.LocalAddr().String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]byte, srv.requestSizeLimit())
+	return &serveConn{
+		rwc: conn, accepted: conn, srv: srv, buf: buf,
+		host: host, port: port,
+		log: log, meta: meta,
+		proxy: connProxyHeader(conn),
+	}, nil
+}
+
+func (srv *Server) logger() Logger {
+	if srv.ErrorLog != nil {
+		return srv.ErrorLog
+	}
+	return stdLogger
+}
+
 func (srv *Server) info() *ServerInfo {
 	if srv.Info != nil {
 		return srv.Info
@@ -170,6 +312,13 @@ func (srv *Server) info() *ServerInfo {
 	return &d
 }
 
+func (srv *Server) errorRenderer() ErrorRenderer {
+	if srv.ErrorRenderer != nil {
+		return srv.ErrorRenderer
+	}
+	return DefaultErrorRenderer
+}
+
 func (srv *Server) addListener(l net.Listener) {
 	srv.lock.Lock()
 	defer srv.lock.Unlock()
@@ -185,19 +334,66 @@ func (srv *Server) removeListener(l net.Listener) {
 	delete(srv.listeners, l)
 }
 
-func (srv *Server) addConn(conn net.Conn) {
+// addConn tracks the connection, and checks it against the connection limits. If
+// the connection should be rejected, the reason is returned. Rejected connections are
+// still tracked, but do not count towards the limits.
+func (srv *Server) addConn(conn net.Conn) (reject error) {
+	ip := addrIP(conn.RemoteAddr())
+
 	srv.lock.Lock()
 	defer srv.lock.Unlock()
 	if srv.conns == nil {
-		srv.conns = make(map[net.Conn]struct{})
+		srv.conns = make(map[net.Conn]connInfo)
+		srv.connsPerIP = make(map[string]int)
 	}
-	srv.conns[conn] = struct{}{}
+
+	if srv.MaxConns > 0 && srv.active >= srv.MaxConns {
+		reject = errServerBusy
+	} else if srv.MaxConnsPerIP > 0 && ip != "" && srv.connsPerIP[ip] >= srv.MaxConnsPerIP {
+		reject = errTooManyConns
+	} else if srv.RateLimiter != nil && !srv.RateLimiter.Allow(conn.RemoteAddr()) {
+		reject = errRateLimited
+	}
+
+	srv.conns[conn] = connInfo{ip: ip, reject: reject}
+	if reject != nil {
+		srv.rejecting++
+	} else {
+		srv.active++
+		if ip != "" {
+			srv.connsPerIP[ip]++
+		}
+	}
+	return reject
+}
+
+func (srv *Server) isRejectingTooMany() bool {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.rejecting > maxRejectingConns
 }
 
 func (srv *Server) removeConn(conn net.Conn) {
 	srv.lock.Lock()
 	defer srv.lock.Unlock()
+	info, ok := srv.conns[conn]
+	if !ok {
+		return
+	}
 	delete(srv.conns, conn)
+
+	if info.reject != nil {
+		srv.rejecting--
+	} else {
+		srv.active--
+		if info.ip != "" {
+			if srv.connsPerIP[info.ip] <= 1 {
+				delete(srv.connsPerIP, info.ip)
+			} else {
+				srv.connsPerIP[info.ip]--
+			}
+		}
+	}
 }
 
 func (srv *Server) readTimeout() time.Duration {
@@ -226,38 +422,110 @@ func (srv *Server) requestSizeLimit() int {
 }
 
 type serveConn struct {
-	srv   *Server
-	rwc   net.Conn
-	buf   []byte
-	isTLS bool
+	srv      *Server
+	rwc      net.Conn
+	accepted net.Conn // rwc may be replaced with a tls.Conn; this never is.
+	buf      []byte
+	isTLS    bool
 
 	host string
 	port string
 	log  Logger
 	meta MetaHandler
+
+	proxy *ProxyHeader
+
+	// Set by readRequest if the request is HTTP rather than gopher:
+	httpData []byte
+
+	// Set by readRequest if the client sent more than the request line:
+	hasBody bool
+
+	// If set, the connection was rejected by the Server's connection limits. We still
+	// read the request so the error can be sent in the client's dialect.
+	reject error
+
+	// tw wraps rwc once the request has been read, so we must wait until after any TLS
+	// upgrade before creating it:
+	tw *trackingWriter
+}
+
+func (c *serveConn) writer() *trackingWriter {
+	if c.tw == nil {
+		var w ResponseWriter = c.rwc
+
+		// Rejected connections already have a deadline for the whole exchange:
+		if c.reject == nil && (c.srv.WriteTimeout > 0 || c.srv.WriteIdleTimeout > 0 || c.srv.WriteRateLimit > 0) {
+			w = newConnWriter(c.rwc, c.srv)
+		}
+		c.tw = &trackingWriter{w: w}
+	}
+	return c.tw
 }
 
 func (c *serveConn) serve(ctx context.Context) {
 	defer func() {
 		if err := recover(); err != nil {
 			_, file, line, _ := runtime.Caller(4)
-			remoteAddr := c.rwc.RemoteAddr().String()
+			remoteAddr := connRemoteAddrString(c.rwc)
 			c.log.Printf("gopher: panic serving %s at %s:%d: %v\n", remoteAddr, file, line, err)
 		}
 	}()
 
-	defer c.rwc.Close()
+	var hijacked bool
+	defer func() {
+		if hijacked {
+			c.setState(StateHijacked)
+			return
+		}
+		c.rwc.Close()
+		c.setState(StateClosed)
+	}()
 	defer c.srv.removeConn(c.rwc)
 
+	start := time.Now()
 	req, err := c.readRequest(ctx)
-	if err != nil {
-		remoteAddr := c.rwc.RemoteAddr().String()
+	if err == errSniffedHTTP {
+		c.setState(StateActive)
+		c.serveHTTP(c.httpData)
+		return
+
+	} else if err != nil {
+		remoteAddr := connRemoteAddrString(c.rwc)
 		c.log.Printf("gopher: request read from %s failed: %v\n", remoteAddr, err)
+
+		// Only log access if we sent an error response; there's nothing useful to log
+		// for connections that hung up or timed out without sending a request.
+		if c.srv.AccessLog != nil && c.tw != nil {
+			c.srv.AccessLog.LogAccess(&AccessLogEntry{
+				Time:       start,
+				RemoteAddr: c.rwc.RemoteAddr(),
+				TLS:        c.isTLS,
+				Bytes:      c.tw.n,
+				Duration:   time.Since(start),
+				Status:     c.tw.status,
+			})
+		}
 		return
 	}
 
+	if c.srv.AccessLog != nil {
+		defer func() {
+			c.srv.AccessLog.LogAccess(newAccessLogEntry(start, req, c.writer()))
+		}()
+	}
+
+	if c.reject != nil {
+		c.respondError(req.url, req.dialect, StatusUnavailable, c.reject)
+		return
+	}
+
+	c.setState(StateActive)
+
+	w := c.writer()
+
 	if req.url.IsMeta() && c.meta != nil {
-		mw := newMetaWriter(c.rwc, req)
+		mw := newMetaWriter(w, req)
 		c.meta.ServeGopherMeta(ctx, mw, req)
 		if !mw.flushed {
 			if err := mw.Flush(); err != nil {
@@ -265,8 +533,24 @@ func (c *serveConn) serve(ctx context.Context) {
 			}
 		}
 
+	} else if req.dialect == DialectPlus && !req.url.IsMeta() {
+		// Attribute requests without a MetaHandler are served as plain requests, so
+		// clients don't mistake the response for an attribute listing.
+		sw := newServerResponseWriter(w, c.rwc, !c.hasBody)
+		pw := NewPlusResponseWriter(sw)
+		sw.plus = pw
+		c.srv.Handler.ServeGopher(ctx, pw, req)
+		if hijacked = sw.finish(); hijacked {
+			return
+		}
+		if err := pw.Flush(); err != nil {
+			panic(err)
+		}
+
 	} else {
-		c.srv.Handler.ServeGopher(ctx, c.rwc, req)
+		sw := newServerResponseWriter(w, c.rwc, !c.hasBody)
+		c.srv.Handler.ServeGopher(ctx, sw, req)
+		hijacked = sw.finish()
 	}
 }
 
@@ -299,20 +583,42 @@ func (c *serveConn) upgradeTLS(ctx context.Context, buf []byte) (err error) {
 	}
 	c.isTLS = true
 	c.rwc = tls.Server(bufConn, c.srv.TLSConfig)
+	c.setState(StateTLS)
 	return nil
 }
 
-func (c *serveConn) respondError(url URL, status Status, err error) error {
-	// FIXME: not handling incoming gopherIIbis properly yet, so we can only
-	// respond with dirent-style:
-	// FIXME: tab-escape strings?
-	fmt.Fprintf(c.rwc, "3Error: %d, %s\t\tinvalid\t0\r\n", status, err)
+func (c *serveConn) setState(state ConnState) {
+	if hook := c.srv.ConnState; hook != nil {
+		hook(c.accepted, state)
+	}
+}
+
+func (c *serveConn) respondError(url URL, dialect Dialect, status Status, err error) error {
+	info := &ErrorInfo{
+		Status:   status,
+		Message:  err.Error(),
+		URL:      url,
+		Dialect:  dialect,
+		ItemType: guessItemType(url),
+	}
+	w := c.writer()
+	w.status = status
+	if rerr := c.srv.errorRenderer().RenderError(w, info); rerr != nil {
+		c.log.Printf("gopher: error response to %s failed: %v\n", connRemoteAddrString(c.rwc), rerr)
+	}
 	return err
 }
 
 func (c *serveConn) readRequest(ctx context.Context) (req *Request, err error) {
+	selectorTimeout := c.srv.readSelectorTimeout()
+	if c.reject != nil {
+		// Rejected connections get a hard deadline for the whole exchange:
+		c.rwc.SetDeadline(time.Now().Add(rejectTimeout))
+		selectorTimeout = rejectTimeout
+	}
+
 retryTLS:
-	c.rwc.SetReadDeadline(time.Now().Add(c.srv.readSelectorTimeout()))
+	c.rwc.SetReadDeadline(time.Now().Add(selectorTimeout))
 
 	var max = len(c.buf)
 	var nl, at, sz int
@@ -346,22 +652,28 @@ retryTLS:
 
 	if sz == max {
 		// XXX: We can't know if it's a GopherIIbis request this early:
-		return nil, c.respondError(URL{}, StatusGeneralError, errRequestTooLarge)
+		return nil, c.respondError(URL{}, DialectGopher, StatusGeneralError, errRequestTooLarge)
 	}
 
 found:
-	line, left := c.buf[:nl], c.buf[nl+1:]
+	line, left := c.buf[:nl], c.buf[nl+1:sz]
 	line = dropCR(line)
 
+	if c.srv.HTTPHandler != nil && c.reject == nil && isHTTPRequestLine(line) {
+		c.httpData = c.buf[:sz]
+		return nil, errSniffedHTTP
+	}
+
 	var url = URL{Hostname: c.host, Port: c.port}
 
-	fileFlag, err := populateRequestURL(&url, line)
+	rl, err := populateRequest(&url, line)
 	if err != nil {
-		return nil, c.respondError(url, StatusBadRequest, err)
+		return nil, c.respondError(url, rl.dialect, StatusBadRequest, err)
 	}
 
 	var body io.ReadCloser = c.rwc
-	if len(left) > 0 || fileFlag {
+	if len(left) > 0 || rl.data {
+		c.hasBody = true
 		c.rwc.SetReadDeadline(time.Now().Add(c.srv.readTimeout()))
 
 		multi := io.MultiReader(bytes.NewReader(left), c.rwc)
@@ -372,12 +684,29 @@ found:
 	}
 
 	rq := NewRequest(url, body)
+	rq.format = rl.format
+	rq.view = rl.view
+	rq.dialect = rl.dialect
+	rq.errRenderer = c.srv.ErrorRenderer
+	rq.log = c.log
 	rq.SelectorPrefix = c.srv.SelectorPrefix
-	rq.RemoteAddr = c.rwc.RemoteAddr().(*net.TCPAddr)
+	rq.RemoteAddr, _ = c.rwc.RemoteAddr().(*net.TCPAddr)
+	if tc, ok := c.rwc.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		rq.TLS = &state
+	}
+	rq.Proxy = c.proxy
 
 	return rq, nil
 }
 
+func connRemoteAddrString(conn net.Conn) string {
+	if addr := conn.RemoteAddr(); addr != nil {
+		return addr.String()
+	}
+	return "<unknown>"
+}
+
 func dropCR(data []byte) []byte {
 	sz := len(data)
 	if len(data) > 0 && data[sz-1] == '\r' {
@@ -386,42 +715,157 @@ func dropCR(data []byte) []byte {
 	return data
 }
 
-func populateRequestURL(url *URL, line []byte) (fileFlag bool, err error) {
-	var field, s int
+// requestLine contains the parts of the request line that don't belong in the URL.
+type requestLine struct {
+	format  string
+	view    string
+	data    bool
+	dialect Dialect
+}
+
+// populateRequest parses a request line, which may be a plain Gopher request, a
+// GopherIIbis request or a Gopher+ request:
+//
+//	<selector>[CR][LF]
+//	<selector>^I<search>[CR][LF]
+//	<selector>^I<search>^I<format><dataflag>[CR][LF]   (GopherIIbis)
+//	<selector>^I+[<view>][^I<dataflag>][CR][LF]         (Gopher+)
+//	<selector>^I<search>^I+[<view>][^I<dataflag>][CR][LF]
+//	<selector>^I$[<attributes>][CR][LF]
+//
+// If the data flag is '1', a data block follows the request line.
+func populateRequest(url *URL, line []byte) (rl requestLine, err error) {
+	const maxFields = 4
+
+	var fields [maxFields][]byte
+	var n, s int
 	var sz = len(line)
 
+	for i := 0; i <= sz && n < maxFields; i++ {
+		if i == sz || line[i] == '\t' {
+			fields[n] = line[s:i]
+			n, s = n+1, i+1
+		}
+	}
+
+	// XXX: Gopher clients could send us any old garbage after the fields we understand.
+	// We ignore it and carry on rather than refuse the request.
+
 	url.ItemType = Text
+	url.Selector = string(fields[0])
+	url.Root = url.Selector == ""
+
+	next := 1
+	if n > next {
+		search := fields[next]
+		next++
+
+		// Searches can start with '+' or '$' too, so only the exact Gopher+ forms are
+		// taken to be Gopher+ requests:
+		if isPlusView(search) {
+			// Gopher+ item request with no search; the search field is the view:
+			return rl, populatePlus(&rl, search, fields[next:n])
+
+		} else if isPlusDirAttributes(search) {
+			// Gopher+ directory attribute request, which we translate to the GopherIIbis
+			// equivalent so MetaHandlers only have to deal with one thing:
+			rl.dialect = DialectPlus
+			url.Search = string(MetaDir) + string(search[1:])
+			return rl, nil
+		}
 
-	for i := 0; i <= sz; i++ {
-		if i == sz || line[i] == '\t' {
-			switch field {
-			case 0:
-				url.Selector = string(line[s:i])
-				url.Root = url.Selector == ""
-				field, s = field+1, i+1
-
-			case 1:
-				url.Search = string(line[s:i])
-				field, s = field+1, i+1
-
-			case 2:
-				ok := i-s == 1 && (line[s] == '0' || line[s] == '1')
-				if !ok {
-					// XXX: perhaps invalid file flags should just be ignored?
-					return false, errRequestFileFlagInvalid
-				}
-				fileFlag = line[s] == '1'
-				field, s = field+1, i+1
+		url.Search = string(search)
+		if url.MetaType() == MetaItem {
+			// '!' is the Gopher+ item attribute request, which GopherIIbis borrowed.
+			// Both expect the same '+-1' listing, and Gopher+ errors still start
+			// with '--', so GopherIIbis clients can detect them too:
+			rl.dialect = DialectPlus
+		} else if url.IsMeta() {
+			rl.dialect = DialectIIbis
+		}
+	}
 
-			case 3:
-				// XXX: Gopher clients could send us any old garbage. Should we ignore
-				// and carry on?
-				return fileFlag, errRequestTrailingData
-			}
+	if n > next {
+		f := fields[next]
+		next++
+
+		if len(f) > 0 && f[0] == '+' {
+			return rl, populatePlus(&rl, f, fields[next:n])
+		}
+
+		// Anything else with a third field is presumed to be GopherIIbis, even if it's
+		// invalid, so errors are sent back in a form the client expects:
+		rl.dialect = DialectIIbis
+
+		// The format string is immediately followed by the data flag. The format
+		// string may be empty, but the flag may not:
+		flen := len(f)
+		if flen == 0 || (f[flen-1] != '0' && f[flen-1] != '1') {
+			// XXX: perhaps invalid file flags should just be ignored?
+			return rl, errRequestFileFlagInvalid
+		}
+		rl.format = string(f[:flen-1])
+		rl.data = f[flen-1] == '1'
+	}
+
+	return rl, nil
+}
+
+// isPlusView reports whether b is a Gopher+ view request; a '+', optionally followed by
+// a MIME type and a language, i.e. '+text/plain En_US'.
+func isPlusView(b []byte) bool {
+	if len(b) == 0 || b[0] != '+' {
+		return false
+	}
+	view := b[1:]
+	if len(view) == 0 {
+		return true
+	}
+	if sp := bytes.IndexByte(view, ' '); sp >= 0 {
+		if !isMIMEToken(view[sp+1:]) {
+			return false
 		}
+		view = view[:sp]
 	}
+	slash := bytes.IndexByte(view, '/')
+	return slash >= 0 && isMIMEToken(view[:slash]) && isMIMEToken(view[slash+1:])
+}
+
+// isPlusDirAttributes reports whether b is a Gopher+ directory attribute request; a
+// '$', optionally followed by the attributes, i.e. '$+ABSTRACT+ADMIN'.
+func isPlusDirAttributes(b []byte) bool {
+	if len(b) == 0 || b[0] != '$' {
+		return false
+	}
+	return len(b) == 1 || (b[1] == '+' && isMIMEToken(b[1:]))
+}
 
-	return fileFlag, nil
+// isMIMEToken reports whether b is a 'token' from RFC 2045.
+func isMIMEToken(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte("()<>@,;:\\\"/[]?=", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func populatePlus(rl *requestLine, view []byte, rest [][]byte) error {
+	rl.dialect = DialectPlus
+	rl.view = string(view[1:])
+
+	if len(rest) > 0 {
+		// Gopher+ sends the data flag in its own field:
+		f := rest[0]
+		if len(f) != 1 || (f[0] != '0' && f[0] != '1') {
+			return errRequestFileFlagInvalid
+		}
+		rl.data = f[0] == '1'
+	}
+	return nil
 }
 
 func resolveHostPort(host string) (rhost string, rport string, err error) {
@@ -1,33 +1,68 @@
 package gopher
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestPopulateRequestURL(t *testing.T) {
+func TestPopulateRequest(t *testing.T) {
 	const withData, noData = true, false
 
-	// func populateRequestURL(url *URL, line []byte) (hasData bool, err error) {
 	for idx, tc := range []struct {
-		line string
-		out  string
-		data bool
+		line    string
+		out     string
+		format  string
+		data    bool
+		dialect Dialect
 	}{
-		{"", "gopher://invalid", noData},
-		{"foo", "gopher://invalid/0foo", noData},
-		{"foo\tsearch", "gopher://invalid/0foo%09search", noData},
-		{"foo\tsearch\t1", "gopher://invalid/0foo%09search", withData},
-		{"foo\t\t1", "gopher://invalid/0foo", withData},
+		{"", "gopher://invalid", "", noData, DialectGopher},
+		{"foo", "gopher://invalid/0foo", "", noData, DialectGopher},
+		{"foo\tsearch", "gopher://invalid/0foo%09search", "", noData, DialectGopher},
+		{"foo\tsearch\t1", "gopher://invalid/0foo%09search", "", withData, DialectIIbis},
+		{"foo\t\t1", "gopher://invalid/0foo", "", withData, DialectIIbis},
+		{"foo\t\t0", "gopher://invalid/0foo", "", noData, DialectIIbis},
+		{"foo\t\ttext/plain0", "gopher://invalid/0foo", "text/plain", noData, DialectIIbis},
+		{"foo\tsearch\ten-AU1", "gopher://invalid/0foo%09search", "en-AU", withData, DialectIIbis},
+		{"foo\t!", "gopher://invalid/0foo%09%21", "", noData, DialectPlus},
+		{"foo\t!+ABSTRACT", "gopher://invalid/0foo%09%21+ABSTRACT", "", noData, DialectPlus},
+		{"foo\t&", "gopher://invalid/0foo%09&", "", noData, DialectIIbis},
+		{"foo\t\t1\tjunk", "gopher://invalid/0foo", "", withData, DialectIIbis},
+
+		{"foo\t+", "gopher://invalid/0foo", "", noData, DialectPlus},
+		{"foo\t+\t1", "gopher://invalid/0foo", "", withData, DialectPlus},
+		{"foo\t+text/plain", "gopher://invalid/0foo", "", noData, DialectPlus},
+		{"foo\tsearch\t+", "gopher://invalid/0foo%09search", "", noData, DialectPlus},
+		{"foo\tsearch\t+\t1", "gopher://invalid/0foo%09search", "", withData, DialectPlus},
+		{"foo\t$", "gopher://invalid/0foo%09&", "", noData, DialectPlus},
+		{"foo\t$+ABSTRACT", "gopher://invalid/0foo%09&+ABSTRACT", "", noData, DialectPlus},
+		{"foo\t+text/plain En_US", "gopher://invalid/0foo", "", noData, DialectPlus},
+
+		// Ordinary searches that happen to start with '+' or '$':
+		{"foo\t+foo", "gopher://invalid/0foo%09+foo", "", noData, DialectGopher},
+		{"foo\t+1 and +2", "gopher://invalid/0foo%09+1%20and%20+2", "", noData, DialectGopher},
+		{"foo\t$5", "gopher://invalid/0foo%09$5", "", noData, DialectGopher},
+		{"foo\t$ off", "gopher://invalid/0foo%09$%20off", "", noData, DialectGopher},
+		{"foo\t+foo\t1", "gopher://invalid/0foo%09+foo", "", withData, DialectIIbis},
 	} {
 		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
 			var u = URL{Hostname: "invalid"}
-			hasData, err := populateRequestURL(&u, []byte(tc.line))
+			rl, err := populateRequest(&u, []byte(tc.line))
 			if err != nil {
 				t.Fatal(err)
 			}
-			if hasData != tc.data {
-				t.Fatal(err)
+			if rl.data != tc.data {
+				t.Fatal(rl.data, "!=", tc.data)
+			}
+			if rl.format != tc.format {
+				t.Fatal(rl.format, "!=", tc.format)
+			}
+			if rl.dialect != tc.dialect {
+				t.Fatal(rl.dialect, "!=", tc.dialect)
 			}
 			if u.String() != tc.out {
 				t.Fatal(u.String(), "!=", tc.out)
@@ -35,3 +70,194 @@ func TestPopulateRequestURL(t *testing.T) {
 		})
 	}
 }
+
+func TestPopulateRequestInvalid(t *testing.T) {
+	for idx, tc := range []struct {
+		line    string
+		dialect Dialect
+	}{
+		{"foo\tsearch\t", DialectIIbis},
+		{"foo\tsearch\t2", DialectIIbis},
+		{"foo\tsearch\ttext/plain", DialectIIbis},
+		{"foo\t+\t2", DialectPlus},
+		{"foo\tsearch\t+\tyep", DialectPlus},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			var u = URL{Hostname: "invalid"}
+			rl, err := populateRequest(&u, []byte(tc.line))
+			if err == nil {
+				t.Fatal()
+			}
+			if rl.dialect != tc.dialect {
+				t.Fatal(rl.dialect, "!=", tc.dialect)
+			}
+		})
+	}
+}
+
+func TestServerIIbisRequest(t *testing.T) {
+	var rqs = make(chan *Request, 1)
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			rqs <- r
+			tw := NewTextWriter(w)
+			tw.WriteString("yep")
+			tw.MustFlush()
+		}),
+	}
+	addr := testServe(t, srv)
+
+	out := testRawRequest(t, addr, "foo\tbar\ttext/plain0\r\n")
+	if out != "yep\r\n.\r\n" {
+		t.Fatalf("%q", out)
+	}
+	rq := <-rqs
+	if rq.Dialect() != DialectIIbis || rq.Format() != "text/plain" || rq.URL().Search != "bar" {
+		t.Fatal(rq.Dialect(), rq.Format(), rq.URL())
+	}
+}
+
+func TestServerIIbisError(t *testing.T) {
+	srv := &Server{Handler: nilHandler}
+	addr := testServe(t, srv)
+
+	out := testRawRequest(t, addr, "foo\tbar\tnope\r\n")
+	if !strings.HasPrefix(out, "--400\r\n") || !strings.HasSuffix(out, "\r\n.\r\n") {
+		t.Fatalf("%q", out)
+	}
+	err := DetectError([]byte(out), func(status Status, msg string, confidence float64) *Error {
+		return NewError(URL{}, status, msg, confidence)
+	})
+	if err == nil || err.Status != StatusBadRequest || err.Confidence != 1 {
+		t.Fatal(err)
+	}
+}
+
+func TestServerSearchNotPlus(t *testing.T) {
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			tw := NewTextWriter(w)
+			tw.WriteString(r.Dialect().String() + " " + r.URL().Search)
+			tw.MustFlush()
+		}),
+	}
+	addr := testServe(t, srv)
+
+	for idx, tc := range []struct {
+		in, out string
+	}{
+		{"find\t+foo\r\n", "gopher +foo\r\n.\r\n"},
+		{"find\t$5\r\n", "gopher $5\r\n.\r\n"},
+		{"find\t+ 1\r\n", "gopher + 1\r\n.\r\n"},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			out := testRawRequest(t, addr, tc.in)
+			if out != tc.out {
+				t.Fatalf("%q != %q", out, tc.out)
+			}
+		})
+	}
+}
+
+func TestServerPlusAttributesWithoutMeta(t *testing.T) {
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			tw := NewTextWriter(w)
+			tw.WriteString("yep")
+			tw.MustFlush()
+		}),
+	}
+	addr := testServe(t, srv)
+
+	// Without a MetaHandler, the '!' is ignored rather than answered with a Gopher+
+	// header the client would take for an attribute listing:
+	out := testRawRequest(t, addr, "foo\t!+ABSTRACT\r\n")
+	if out != "yep\r\n.\r\n" {
+		t.Fatalf("%q", out)
+	}
+}
+
+var nilLogger = &logger{printf: func(format string, v ...interface{}) {}}
+
+func portOf(addr string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		panic(err)
+	}
+	return port
+}
+
+func testServe(t *testing.T, srv *Server) (addr string) {
+	t.Helper()
+	if srv.ErrorLog == nil {
+		srv.ErrorLog = nilLogger
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln, "")
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func testRawRequest(t *testing.T, addr string, rq string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte(rq)); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestServerPlusRequest(t *testing.T) {
+	mux := NewMux()
+	mux.Handle("text", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		tw := NewTextWriter(w)
+		tw.WriteString(r.PlusView())
+		tw.MustFlush()
+	}), nil)
+	mux.Handle("bin", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Write([]byte("bin"))
+	}), nil)
+	mux.Handle("sized", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		PlusWriter(w).SetSize(3)
+		w.Write([]byte("bin"))
+	}), nil)
+
+	addr := testServe(t, &Server{Handler: mux})
+
+	for idx, tc := range []struct {
+		in, out string
+	}{
+		{"text\t+\r\n", "+-1\r\n.\r\n"},
+		{"text\t+text/plain\r\n", "+-1\r\ntext/plain\r\n.\r\n"},
+		{"bin\t+\r\n", "+-2\r\nbin"},
+		{"sized\t+\r\n", "+3\r\nbin"},
+		{"bin\r\n", "bin"},
+		{"nope\t+\r\n", "--1\r\n1 Error: 404, Not found: gopher://127.0.0.1:" + portOf(addr) + "/0nope\r\n.\r\n"},
+		{"nope\t+text/plain\r\n", "--1\r\n1 Error: 404, Not found: gopher://127.0.0.1:" + portOf(addr) + "/0nope\r\n.\r\n"},
+		{"nope\t+\t2\r\n", "--1\r\n1 Error: 400, client sent an invalid file flag\r\n.\r\n"},
+		{"text\t$\r\n", "+-1\r\n+INFO: 0text\ttext\t127.0.0.1\t" + portOf(addr) + "\t+\r\n.\r\n"},
+		{"text\t!\r\n", "+-1\r\n+INFO: 0text\ttext\t127.0.0.1\t" + portOf(addr) + "\t+\r\n.\r\n"},
+		{"text\t!+ABSTRACT\r\n", "+-1\r\n+INFO: 0text\ttext\t127.0.0.1\t" + portOf(addr) + "\t+\r\n.\r\n"},
+		{"nope\t!\r\n", "--1\r\n1 Error: 404, Not found: \"nope\"\r\n.\r\n"},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			out := testRawRequest(t, addr, tc.in)
+			if out != tc.out {
+				t.Fatalf("%q != %q", out, tc.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package gopher
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrHijacked is returned by writes to a ServerResponseWriter after Hijack() has been
+// called.
+var ErrHijacked = errors.New("gopher: connection has been hijacked")
+
+// ServerResponseWriter is implemented by the ResponseWriter that Server passes to
+// Handlers. Handlers and middleware should find it with ServerWriter() rather than a
+// type assertion, as it may be wrapped by other middleware.
+//
+// Middleware that wraps a ResponseWriter should provide an 'Unwrap() ResponseWriter'
+// method, so the ServerResponseWriter can still be found.
+type ServerResponseWriter interface {
+	ResponseWriter
+
+	// Written returns the number of bytes sent to the client so far, including
+	// anything written by the Server, like the Gopher+ header.
+	Written() int64
+
+	// Status returns the status of the response. This is OK unless an error was sent
+	// with RespondError(), or SetStatus() was called.
+	Status() Status
+
+	// SetStatus records the status of the response for middleware and the access log.
+	// It does not send anything to the client. RespondError() calls SetStatus.
+	SetStatus(status Status)
+
+	// ItemType returns the item type hinted by SetItemType(), or NoItemType.
+	ItemType() ItemType
+
+	// SetItemType hints the item type of the response. RespondError() uses the hint
+	// to send errors in a form the client expects, rather than guessing from the
+	// selector. NewDirWriter() and NewTextWriter() set the hint for you.
+	SetItemType(i ItemType)
+
+	// Flush sends anything the Server has not sent yet, i.e. the Gopher+ header if
+	// nothing has been written. Server does not otherwise buffer writes.
+	Flush() error
+
+	// Hijack takes over the connection. After Hijack, the Server will not write to or
+	// close the connection, and writes to the ServerResponseWriter fail with
+	// ErrHijacked. The caller is responsible for the connection's deadlines.
+	Hijack() (net.Conn, error)
+
+	// CloseNotify returns a channel that is closed when the client goes away, or
+	// when the Server is finished with the connection. If the request has a body,
+	// the client going away is not noticed, so the channel is only closed when the
+	// Server is finished with the connection.
+	CloseNotify() <-chan struct{}
+}
+
+// ServerWriter returns the ServerResponseWriter that w wraps, or nil if there isn't
+// one, i.e. w did not come from a Server.
+func ServerWriter(w ResponseWriter) ServerResponseWriter {
+	var sw ServerResponseWriter
+	unwrapResponseWriter(w, func(w interface{}) bool {
+		sw, _ = w.(ServerResponseWriter)
+		return sw != nil
+	})
+	return sw
+}
+
+// hintItemType sets the item type hint on the ServerResponseWriter w wraps, if it has
+// not already been set.
+func hintItemType(w interface{}, i ItemType) {
+	unwrapResponseWriter(w, func(w interface{}) bool {
+		sw, ok := w.(ServerResponseWriter)
+		if ok && sw.ItemType() == NoItemType {
+			sw.SetItemType(i)
+		}
+		return ok
+	})
+}
+
+// responseItemType returns the item type hint from the ServerResponseWriter w wraps.
+func responseItemType(w interface{}) (i ItemType) {
+	unwrapResponseWriter(w, func(w interface{}) bool {
+		sw, ok := w.(ServerResponseWriter)
+		if ok {
+			i = sw.ItemType()
+		}
+		return ok
+	})
+	return i
+}
+
+type serverResponseWriter struct {
+	tw       *trackingWriter
+	conn     net.Conn
+	plus     *PlusResponseWriter // Set for Gopher+ requests; it wraps the serverResponseWriter
+	itemType ItemType
+
+	mu       sync.Mutex
+	hijacked bool
+	done     bool
+	closed   chan struct{}
+	notified bool
+	watching chan struct{} // Closed when the CloseNotify read returns
+	watch    bool          // Whether CloseNotify may read from conn
+}
+
+var _ ServerResponseWriter = &serverResponseWriter{}
+
+func newServerResponseWriter(tw *trackingWriter, conn net.Conn, watch bool) *serverResponseWriter {
+	return &serverResponseWriter{tw: tw, conn: conn, watch: watch}
+}
+
+func (sw *serverResponseWriter) Unwrap() ResponseWriter { return sw.tw }
+
+func (sw *serverResponseWriter) Write(b []byte) (int, error) {
+	if sw.isHijacked() {
+		return 0, ErrHijacked
+	}
+	return sw.tw.Write(b)
+}
+
+func (sw *serverResponseWriter) Written() int64         { return sw.tw.n }
+func (sw *serverResponseWriter) Status() Status         { return sw.tw.status }
+func (sw *serverResponseWriter) SetStatus(s Status)     { setResponseStatus(sw.tw, s) }
+func (sw *serverResponseWriter) ItemType() ItemType     { return sw.itemType }
+func (sw *serverResponseWriter) SetItemType(i ItemType) { sw.itemType = i }
+
+func (sw *serverResponseWriter) Flush() error {
+	if sw.isHijacked() {
+		return ErrHijacked
+	}
+	if sw.plus != nil {
+		return sw.plus.Flush()
+	}
+	return nil
+}
+
+func (sw *serverResponseWriter) isHijacked() bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.hijacked
+}
+
+func (sw *serverResponseWriter) Hijack() (net.Conn, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.hijacked {
+		return nil, ErrHijacked
+	}
+	if sw.done {
+		return nil, errors.New("gopher: hijack after handler returned")
+	}
+	sw.hijacked = true
+	sw.stopWatching()
+	return sw.conn, nil
+}
+
+func (sw *serverResponseWriter) CloseNotify() <-chan struct{} {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.closed == nil {
+		sw.closed = make(chan struct{})
+		if sw.done || sw.hijacked {
+			sw.notify()
+		} else if sw.watch {
+			sw.watching = make(chan struct{})
+			go sw.watchClose()
+		}
+	}
+	return sw.closed
+}
+
+// watchClose reads from the connection until it fails, which happens when the client
+// hangs up. Gopher clients don't send anything after the request, so anything read
+// is discarded.
+func (sw *serverResponseWriter) watchClose() {
+	defer close(sw.watching)
+	sw.conn.SetReadDeadline(time.Time{})
+
+	var buf [64]byte
+	for {
+		if _, err := sw.conn.Read(buf[:]); err != nil {
+			break
+		}
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if !sw.hijacked {
+		sw.notify()
+	}
+}
+
+// notify closes the CloseNotify channel if it exists. sw.mu must be held.
+func (sw *serverResponseWriter) notify() {
+	if sw.closed != nil && !sw.notified {
+		sw.notified = true
+		close(sw.closed)
+	}
+}
+
+// stopWatching interrupts the CloseNotify read, so the connection can be handed over
+// by Hijack. sw.mu must be held.
+func (sw *serverResponseWriter) stopWatching() {
+	if sw.watching != nil {
+		sw.conn.SetReadDeadline(aLongTimeAgo)
+		sw.mu.Unlock()
+		<-sw.watching
+		sw.mu.Lock()
+		sw.conn.SetReadDeadline(time.Time{})
+	}
+	sw.notify()
+}
+
+// finish is called by the Server when the Handler has returned. It reports whether the
+// connection was hijacked.
+func (sw *serverResponseWriter) finish() (hijacked bool) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.done = true
+	if sw.watching == nil {
+		// Otherwise the CloseNotify read will notice when the Server closes the
+		// connection.
+		sw.notify()
+	}
+	return sw.hijacked
+}
+
+var aLongTimeAgo = time.Unix(1, 0)
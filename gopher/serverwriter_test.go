@@ -0,0 +1,139 @@
+package gopher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServerResponseWriter(t *testing.T) {
+	// Handlers report what they see here, as they run in the Server's goroutine:
+	seen := make(chan interface{}, 1)
+
+	mux := NewMux()
+	mux.Handle("written", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Write([]byte("hello"))
+		seen <- ServerWriter(w).Written()
+	}), nil)
+	mux.Handle("status", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		RespondError(w, r, StatusGone, "Gone")
+		seen <- ServerWriter(w).Status()
+	}), nil)
+	mux.Handle("itemtype", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		ServerWriter(w).SetItemType(Text)
+		RespondError(w, r, StatusGone, "Gone")
+		seen <- nil
+	}), nil)
+	mux.Handle("plus", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		// The Gopher+ header is sent when we flush, before anything is written:
+		sw := ServerWriter(w)
+		sw.Flush()
+		seen <- sw.Written()
+	}), nil)
+
+	srv := &Server{Handler: Chain(mux, Recover(nilLogger))}
+	addr := testServe(t, srv)
+
+	for idx, tc := range []struct {
+		in   string
+		out  string
+		seen interface{}
+	}{
+		{"written\r\n", "hello", int64(5)},
+		{"status\r\n", "3Error: 410, Gone\t\tinvalid\t0\r\n.\r\n", StatusGone},
+
+		// The hint wins over the Dir guessed from a selector with no extension:
+		{"itemtype\r\n", "Error: 410, Gone\r\n.\r\n", nil},
+
+		{"plus\t+\r\n", "+-2\r\n", int64(5)},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			out := testRawRequest(t, addr, tc.in)
+			if s := <-seen; out != tc.out || s != tc.seen {
+				t.Fatalf("%q %v", out, s)
+			}
+		})
+	}
+}
+
+func TestServerResponseWriterHijack(t *testing.T) {
+	var mu sync.Mutex
+	var states []ConnState
+	writeErr := make(chan error, 1)
+
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			conn, err := ServerWriter(w).Hijack()
+			if err != nil {
+				panic(err)
+			}
+			_, err = w.Write([]byte("nope"))
+			writeErr <- err
+			go func() {
+				defer conn.Close()
+				time.Sleep(10 * time.Millisecond)
+				conn.Write([]byte("hijacked"))
+			}()
+		}),
+		ConnState: func(conn net.Conn, state ConnState) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, state)
+		},
+	}
+	addr := testServe(t, srv)
+
+	if out := testRawRequest(t, addr, "foo\r\n"); out != "hijacked" {
+		t.Fatalf("%q", out)
+	}
+	if err := <-writeErr; err != ErrHijacked {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(states) != "[new active hijacked]" {
+		t.Fatal(states)
+	}
+}
+
+func TestServerResponseWriterCloseNotify(t *testing.T) {
+	done := make(chan struct{})
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			defer close(done)
+			w.Write([]byte("waiting"))
+			select {
+			case <-ServerWriter(w).CloseNotify():
+			case <-time.After(5 * time.Second):
+			}
+		}),
+	}
+	addr := testServe(t, srv)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("foo\r\n"))
+	buf := make([]byte, 7)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	conn.Close()
+	<-done
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("close not noticed")
+	}
+}
+
+func TestServerWriterMissing(t *testing.T) {
+	if ServerWriter(ioutil.Discard) != nil {
+		t.Fatal()
+	}
+}
@@ -0,0 +1,68 @@
+package gopher
+
+import (
+	"context"
+	"path"
+)
+
+// SitemapHandler serves a directory listing every static route in Mux that was given an
+// ItemType with RouteItem(), so the site can be indexed without keeping a list by hand:
+//
+//	mux.Handle("/about.txt", aboutHandler, nil, gopher.RouteItem(gopher.Text, "About"))
+//	mux.Handle("/phlog", phlogHandler, nil, gopher.RouteItem(gopher.Dir, "Phlog"))
+//	mux.Handle("/sitemap", &gopher.SitemapHandler{Mux: mux}, nil)
+//
+// Routes with params, and routes without an ItemType, are left out. Muxes mounted with
+// Mount() are included under their mount prefix. Each selector is only listed once.
+type SitemapHandler struct {
+	Mux *Mux
+
+	// If set, Title is written as an info line before the listing.
+	Title string
+}
+
+var _ Handler = &SitemapHandler{}
+
+func (sh *SitemapHandler) ServeGopher(ctx context.Context, w ResponseWriter, r *Request) {
+	dw := NewDirWriter(w, r)
+	if sh.Title != "" {
+		dw.Info(sh.Title)
+	}
+	sh.writeRoutes(dw, sh.Mux, "", make(map[string]bool))
+	dw.MustFlush()
+}
+
+func (sh *SitemapHandler) writeRoutes(dw *DirWriter, mux *Mux, prefix string, seen map[string]bool) {
+	for _, route := range mux.Routes() {
+		if inner, ok := route.Mount.(*Mux); ok && inner != mux {
+			mountPrefix := prefix
+			if route.Pattern != "/" {
+				mountPrefix += route.Pattern
+			}
+			sh.writeRoutes(dw, inner, mountPrefix, seen)
+			continue
+		}
+
+		if !route.IsStatic() || route.ItemType == NoItemType {
+			continue
+		}
+
+		sel := route.Pattern
+		if prefix != "" {
+			sel = prefix
+			if route.Pattern != "/" {
+				sel += route.Pattern
+			}
+		}
+		if seen[sel] {
+			continue
+		}
+		seen[sel] = true
+
+		disp := route.Display
+		if disp == "" {
+			disp = path.Base(sel)
+		}
+		dw.Selector(route.ItemType, disp, sel)
+	}
+}
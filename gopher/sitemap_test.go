@@ -0,0 +1,71 @@
+package gopher
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestSitemapHandler(t *testing.T) {
+	inner := NewMux()
+	inner.Handle("/", nilHandler, nil, RouteItem(Dir, "Files"))
+	inner.Handle("/a.txt", nilHandler, nil, RouteItem(Text, "A"))
+	inner.Handle("/b.txt", nilHandler, nil)
+
+	mux := NewMux()
+	mux.Handle("/about.txt", nilHandler, nil, RouteItem(Text, ""))
+	mux.Handle("/find", nilHandler, nil, RouteSearch(false), RouteItem(Search, "Find"))
+	mux.Handle("/find", nilHandler, nil, RouteSearch(true), RouteItem(Search, "Find again"))
+	mux.Handle("/user/:user", nilHandler, nil, RouteItem(Dir, "User"))
+	mux.Handle("/sitemap", &SitemapHandler{Mux: mux, Title: "Sitemap"}, nil)
+	mux.Mount("/files", inner)
+
+	var out bytes.Buffer
+	rq := NewRequest(URL{Hostname: "localhost", Port: "70", Selector: "/sitemap"}, nil)
+	rq.SelectorPrefix = "/pfx"
+	mux.ServeGopher(context.Background(), &out, rq)
+
+	expected := "" +
+		"iSitemap\tnull\tinvalid\t0\r\n" +
+		"0about.txt\t/pfx/about.txt\tlocalhost\t70\r\n" +
+		"1Files\t/pfx/files\tlocalhost\t70\r\n" +
+		"0A\t/pfx/files/a.txt\tlocalhost\t70\r\n" +
+		"7Find\t/pfx/find\tlocalhost\t70\r\n" +
+		".\r\n"
+	if out.String() != expected {
+		t.Fatalf("%q", out.String())
+	}
+}
+
+func TestSitemapHandlerGroupMount(t *testing.T) {
+	inner := NewMux()
+	inner.Handle("/a.txt", nilHandler, nil, RouteItem(Text, "A"))
+
+	var served bool
+	mw := func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			served = true
+			h.ServeGopher(ctx, w, r)
+		})
+	}
+
+	mux := NewMux()
+	mux.Handle("/sitemap", &SitemapHandler{Mux: mux}, nil)
+	mux.Group("/admin", mw).Mount("/files", inner)
+
+	var out bytes.Buffer
+	mux.ServeGopher(context.Background(), &out, NewRequest(URL{Hostname: "localhost", Port: "70", Selector: "/sitemap"}, nil))
+
+	expected := "" +
+		"0A\t/admin/files/a.txt\tlocalhost\t70\r\n" +
+		".\r\n"
+	if out.String() != expected {
+		t.Fatalf("%q", out.String())
+	}
+
+	// The group's middleware still applies to requests for the mounted Mux:
+	mux.ServeGopher(context.Background(), &bytes.Buffer{}, NewRequest(URL{Selector: "/admin/files/a.txt"}, nil))
+	if !served {
+		t.Fatal()
+	}
+}
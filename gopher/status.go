@@ -32,3 +32,26 @@ const (
 func (s Status) Error() string {
 	return fmt.Sprintf("%d", s)
 }
+
+var statusText = map[Status]string{
+	StatusBadRequest:     "Bad request",
+	StatusUnauthorized:   "Unauthorized",
+	StatusForbidden:      "Forbidden",
+	StatusNotFound:       "Not found",
+	StatusRequestTimeout: "Request timeout",
+	StatusGone:           "Gone",
+	StatusInternal:       "Internal server error",
+	StatusNotImplemented: "Not implemented",
+	StatusUnavailable:    "Unavailable",
+	StatusGeneralError:   "Error",
+	StatusEmpty:          "Empty",
+}
+
+// StatusText returns a short message describing the status, i.e. "Not found", or
+// "Error" if the status is unknown.
+func StatusText(s Status) string {
+	if text, ok := statusText[s]; ok {
+		return text
+	}
+	return "Error"
+}
@@ -3,8 +3,6 @@ package gopherfs
 import (
 	"bufio"
 	"context"
-	"errors"
-	"fmt"
 	"io"
 	"os"
 	"path"
@@ -72,22 +70,20 @@ func (fsrv *FileServer) ServeGopher(ctx context.Context, w gopher.ResponseWriter
 
 	selector, allowed := fsrv.handleSelector(u.Selector)
 	if !allowed {
-		respondError(w, r, gopher.StatusNotFound, "Error: Not found")
+		gopher.RespondError(w, r, gopher.StatusNotFound, "Not found")
 		return
 	}
 
 	file, err := fsrv.fs.Open(selector)
 	if err != nil {
-		code, msg := toGopherError(err)
-		respondError(w, r, code, msg) // FIXME: allow logging
+		gopher.RespondErr(w, r, err)
 		return
 	}
 	defer file.Close()
 
 	st, err := file.Stat()
 	if err != nil {
-		code, msg := toGopherError(err)
-		respondError(w, r, code, msg) // FIXME: allow logging
+		gopher.RespondErr(w, r, err)
 		return
 	}
 
@@ -107,7 +103,7 @@ func (fsrv *FileServer) ServeGopher(ctx context.Context, w gopher.ResponseWriter
 
 	itemType, allowed := fsrv.findItemType(selector)
 	if !allowed {
-		respondError(w, r, gopher.StatusNotFound, "Error: Not found")
+		gopher.RespondError(w, r, gopher.StatusNotFound, "Not found")
 		return
 	}
 
@@ -131,20 +127,20 @@ func (fsrv *FileServer) ServeGopherMeta(ctx context.Context, w gopher.MetaWriter
 
 	selector, allowed := fsrv.handleSelector(u.Selector)
 	if !allowed {
-		w.MetaError(gopher.StatusNotFound, "Error: not found")
+		w.MetaError(gopher.StatusNotFound, "Not found")
 		return
 	}
 
 	f, err := fsrv.fs.Open(selector)
 	if err != nil {
-		w.MetaError(gopher.StatusNotFound, err.Error())
+		w.MetaError(gopher.ErrorStatus(err))
 		return
 	}
 	defer f.Close()
 
 	itemType, allowed := fsrv.findItemType(selector)
 	if !allowed {
-		w.MetaError(gopher.StatusNotFound, err.Error())
+		w.MetaError(gopher.StatusNotFound, "Not found")
 		return
 	}
 
@@ -290,22 +286,6 @@ func (fsrv *FileServer) findItemType(selector string) (item gopher.ItemType, all
 	return gopher.Text, true
 }
 
-func respondError(w gopher.ResponseWriter, r *gopher.Request, code gopher.Status, msg string) {
-	dw := gopher.NewDirWriter(w, r)
-	defer dw.MustFlush()
-	dw.Error(fmt.Sprintf("Error: %d %s", code, msg))
-}
-
-func toGopherError(err error) (status gopher.Status, msg string) {
-	if errors.Is(err, os.ErrNotExist) {
-		return gopher.StatusNotFound, "Page not found"
-	}
-	if errors.Is(err, os.ErrPermission) {
-		return gopher.StatusForbidden, "Forbidden"
-	}
-	return gopher.StatusInternal, "Internal Server Error"
-}
-
 type files []os.FileInfo
 
 func (f files) Len() int { return len(f) }